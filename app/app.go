@@ -9,6 +9,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"reflect"
 )
 
@@ -44,7 +45,8 @@ func commandLineErrorf(message string, args ...interface{}) error {
 	return commandLineError(fmt.Sprintf(message, args...))
 }
 
-// Main execute application
+// Main execute application, it exits with status 2 for command line error,
+// 1 for other errors
 func Main(ctx context.Context, app Application, args []string) {
 
 	s := flag.NewFlagSet(app.Name(), flag.ExitOnError)
@@ -65,7 +67,9 @@ func Main(ctx context.Context, app Application, args []string) {
 		fmt.Fprintf(s.Output(), "%s\n", e)
 		if _, ok := e.(commandLineError); ok {
 			s.Usage()
+			os.Exit(2)
 		}
+		os.Exit(1)
 	}
 }
 
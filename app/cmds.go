@@ -9,6 +9,8 @@ import (
 	"flag"
 	"fmt"
 
+	"skygo/load"
+	"skygo/machine"
 	"skygo/utils/log"
 )
 
@@ -16,6 +18,7 @@ import (
 type App struct {
 	name     string
 	LogLevel string `flag:"loglevel" help:"Log Level: trace, info, warning(default), error"`
+	Machine  string `flag:"machine" help:"Select machine to build for, refer to command machines"`
 }
 
 // New create top app that implement Application
@@ -56,6 +59,13 @@ func (app *App) Run(ctx context.Context, args ...string) error {
 		}
 	}
 
+	if app.Machine != "" {
+		if _, err := machine.Find(app.Machine); err != nil {
+			return commandLineErrorf("%s", err)
+		}
+		load.Settings().Set(load.MACHINE, app.Machine)
+	}
+
 	if len(args) == 0 {
 		return commandLineErrorf("command must be supplied")
 	}
@@ -74,5 +84,12 @@ func (app *App) commands() []Application {
 	return []Application{
 		&info{name: app.name},
 		&build{name: app.name},
+		&feed{name: app.name},
+		&whichPkg{name: app.name},
+		&pkgdata{name: app.name},
+		&graph{name: app.name},
+		&machines{name: app.name},
+		&layers{name: app.name},
+		&lint{name: app.name},
 	}
 }
@@ -0,0 +1,60 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"skygo/load"
+	"skygo/pkg"
+)
+
+type feed struct {
+	name string //top cmd name
+}
+
+func (*feed) Name() string { return "feed" }
+func (*feed) Summary() string {
+	return "generate package feed index Packages/Packages.gz"
+}
+func (f *feed) UsageLine() string {
+	return fmt.Sprintf(`[arch...]
+
+index package archives under FEEDDIR/<arch>. if no arch is given, all arches
+under FEEDDIR are indexed. the generated feed can be served by any static HTTP
+server, e.g. opkg configuration on target device:
+
+src/gz skygo http://<host>/<arch>
+
+example:
+
+$%s feed arm
+`, f.name)
+}
+func (*feed) Help(f *flag.FlagSet) {}
+
+func (f *feed) Run(ctx context.Context, args ...string) error {
+
+	root := load.Settings().GetStr(load.FEEDDIR)
+
+	arches := args
+	if len(arches) == 0 {
+		var err error
+		if arches, err = pkg.Feeds(root); err != nil {
+			return err
+		}
+	}
+
+	for _, arch := range arches {
+		if err := pkg.Index(filepath.Join(root, arch)); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", arch, filepath.Join(root, arch, "Packages"))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"skygo/carton"
+	"skygo/load"
+)
+
+type graph struct {
+	name   string //top cmd name
+	Format string `flag:"format" help:"output format: tree(default), dot, json"`
+	Depth  int    `flag:"depth" help:"limit depth of dependencies, 0 means unlimited"`
+	Stages bool   `flag:"stages" help:"show stage level dependencies added by AddDep"`
+}
+
+func (*graph) Name() string { return "graph" }
+func (*graph) Summary() string {
+	return "show dependency graph of cartons"
+}
+func (g *graph) UsageLine() string {
+	return fmt.Sprintf(`[carton name...]
+
+show build and runtime dependencies of cartons, or of all cartons if no one
+is given. virtual cartons are resolved to their providers, dependencies of
+carton resolve to variant by its variant, e.g. dependencies of native carton
+are native too.
+
+example:
+
+$%s graph -depth 2 busybox
+$%s graph -format dot busybox | dot -Tsvg > busybox.svg
+`, g.name, g.name)
+}
+func (*graph) Help(f *flag.FlagSet) {
+
+	fmt.Fprintf(f.Output(), "\ngraph flags are:\n")
+	f.PrintDefaults()
+}
+
+func (g *graph) Run(ctx context.Context, args ...string) error {
+
+	var output func(io.Writer, *carton.Graph) error
+	switch g.Format {
+	case "", "tree":
+		output = tree
+	case "dot":
+		output = dot
+	case "json":
+		output = func(w io.Writer, gr *carton.Graph) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(gr)
+		}
+	default:
+		return commandLineErrorf("Unknown format %s", g.Format)
+	}
+
+	l, _ := load.NewLoad(ctx, g.name)
+	gr, err := l.Graph(args, g.Depth, g.Stages)
+	if err != nil {
+		return err
+	}
+	return output(os.Stdout, gr)
+}
+
+// label describes edge @e, e.g. [build] or [stage fetch -> package]
+func label(e *carton.Edge) string {
+
+	var b strings.Builder
+	b.WriteString(e.Kind)
+	if e.FromStage != "" {
+		fmt.Fprintf(&b, " %s ->", e.FromStage)
+	}
+	if e.ToStage != "" {
+		fmt.Fprintf(&b, " @%s", e.ToStage)
+	}
+	if e.Version != "" {
+		fmt.Fprintf(&b, " (%s)", e.Version)
+	}
+	if e.Virtual != "" {
+		fmt.Fprintf(&b, " via %s", e.Virtual)
+	}
+	if e.Optional {
+		b.WriteString(" optional")
+	}
+	return b.String()
+}
+
+// tree prints graph as indented tree, node which has been expanded is
+// marked by (*)
+func tree(w io.Writer, gr *carton.Graph) error {
+
+	expanded := map[string]bool{}
+
+	var walk func(name string, indent string)
+	walk = func(name string, indent string) {
+		for _, e := range gr.Out(name) {
+			mark := ""
+			if expanded[e.To] && len(gr.Out(e.To)) > 0 {
+				mark = " (*)"
+			}
+			fmt.Fprintf(w, "%s%s [%s]%s\n", indent, e.To, label(e), mark)
+			if mark == "" {
+				expanded[e.To] = true
+				walk(e.To, indent+"    ")
+			}
+		}
+	}
+
+	for _, root := range gr.Roots {
+		if expanded[root] {
+			continue
+		}
+		fmt.Fprintln(w, root)
+		expanded[root] = true
+		walk(root, "    ")
+	}
+	return nil
+}
+
+// dot prints graph in graphviz DOT format. cartons running on target are
+// boxes, native and cross cartons are ellipses. runtime edges are solid, build edges are dashed and
+// stage edges are dotted
+func dot(w io.Writer, gr *carton.Graph) error {
+
+	fmt.Fprintln(w, "digraph skygo {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	for _, n := range gr.Nodes {
+		shape := "box"
+		if n.Native {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(w, "\t%q [shape=%s];\n", n.Name, shape)
+	}
+
+	for _, e := range gr.Edges {
+		style := "solid"
+		switch e.Kind {
+		case carton.BuildEdge:
+			style = "dashed"
+		case carton.StageEdge, carton.TaskEdge:
+			style = "dotted"
+		}
+		fmt.Fprintf(w, "\t%q -> %q [style=%s, label=%q];\n", e.From, e.To, style, label(e))
+	}
+	fmt.Fprintln(w, "}")
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"skygo/carton"
+	"skygo/load"
+)
+
+type layers struct {
+	name string //top cmd name
+}
+
+func (*layers) Name() string      { return "layers" }
+func (*layers) UsageLine() string { return "[layer name...]" }
+func (*layers) Summary() string {
+	return "list layers by priority, or show cartons defined or modified by layers if names are given"
+}
+func (*layers) Help(f *flag.FlagSet) {}
+
+func (ls *layers) Run(ctx context.Context, args ...string) error {
+
+	l, _ := load.NewLoad(ctx, ls.name)
+	all := l.Layers()
+
+	if len(args) > 0 {
+		for _, name := range args {
+			layer, err := carton.FindLayer(name)
+			if err != nil {
+				return err
+			}
+			defines, modifies := layer.Cartons()
+			fmt.Print(layer)
+			fmt.Printf(" Defines: %s\n", strings.Join(defines, " "))
+			fmt.Printf("Modifies: %s\n\n", strings.Join(modifies, " "))
+		}
+		return nil
+	}
+
+	for _, layer := range all {
+		defines, modifies := layer.Cartons()
+		fmt.Printf("%-20s %4d  %-40s %d defined, %d modified\n", layer.Name(),
+			layer.Priority, layer.Dir(), len(defines), len(modifies))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"skygo/load"
+)
+
+type lint struct {
+	name   string //top cmd name
+	Format string `flag:"format" help:"output format: text(default), json"`
+}
+
+func (*lint) Name() string { return "lint" }
+func (*lint) Summary() string {
+	return "check all cartons for mistakes without building them"
+}
+func (l *lint) UsageLine() string {
+	return fmt.Sprintf(`
+
+load all cartons and report problems found in one pass, one per line as
+file:line: carton: message [check]. it exits with non-zero status if any
+problem is found, so it can be used by CI.
+
+example:
+
+$%s lint -format json
+`, l.name)
+}
+func (*lint) Help(f *flag.FlagSet) {
+
+	fmt.Fprintf(f.Output(), "\nlint flags are:\n")
+	f.PrintDefaults()
+}
+
+func (l *lint) Run(ctx context.Context, args ...string) error {
+
+	if l.Format != "" && l.Format != "text" && l.Format != "json" {
+		return commandLineErrorf("Unknown format %s", l.Format)
+	}
+
+	problems := load.Lint(ctx)
+	if l.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(problems); err != nil {
+			return err
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Println(p.String())
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	return nil
+}
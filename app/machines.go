@@ -0,0 +1,52 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"skygo/load"
+	"skygo/machine"
+)
+
+type machines struct {
+	name string //top cmd name
+}
+
+func (*machines) Name() string      { return "machines" }
+func (*machines) UsageLine() string { return "[machine name...]" }
+func (*machines) Summary() string {
+	return "list machines, or show details of machines if names are given"
+}
+func (*machines) Help(f *flag.FlagSet) {}
+
+func (*machines) Run(ctx context.Context, args ...string) error {
+
+	if len(args) > 0 {
+		for _, name := range args {
+			m, err := machine.Find(name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n\n", m)
+		}
+		return nil
+	}
+
+	selected := ""
+	if v, ok := load.Settings().Lookup(load.MACHINE); ok {
+		selected, _ = v.(string)
+	}
+	for _, m := range machine.Machines() {
+		mark := " "
+		if m.Name() == selected {
+			mark = "*"
+		}
+		fmt.Printf("%s %-20s %-10s %s\n", mark, m.Name(), m.Arch, m.Desc)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"skygo/load"
+	"skygo/pkg"
+)
+
+// records loads package data of system @sys, or of all systems if @sys is empty
+func records(sys string) (map[string][]*pkg.Record, error) {
+
+	root := load.Settings().GetStr(load.PKGDATADIR)
+
+	systems := []string{sys}
+	if sys == "" {
+		var err error
+		if systems, err = pkg.Systems(root); err != nil {
+			return nil, fmt.Errorf("no package data, build cartons firstly: %s", err)
+		}
+	}
+
+	all := map[string][]*pkg.Record{}
+	for _, s := range systems {
+		r, err := pkg.ReadRecords(pkg.PkgdataDir(root, s))
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(r, func(i, j int) bool { return r[i].Package < r[j].Package })
+		all[s] = r
+	}
+	return all, nil
+}
+
+// sortedSystems returns systems of @all by name
+func sortedSystems(all map[string][]*pkg.Record) []string {
+
+	systems := []string{}
+	for s := range all {
+		systems = append(systems, s)
+	}
+	sort.Strings(systems)
+	return systems
+}
+
+type whichPkg struct {
+	name string //top cmd name
+	Sys  string `flag:"sys" help:"only search packages of system, e.g. arm-linux-gnueabi"`
+}
+
+func (*whichPkg) Name() string { return "which-pkg" }
+func (*whichPkg) Summary() string {
+	return "show which package and carton ship the file"
+}
+func (w *whichPkg) UsageLine() string {
+	return fmt.Sprintf(`<path...>
+
+path is absolute path on target, glob pattern is supported. packages of all
+built systems are searched unless flag sys is given.
+
+example:
+
+$%s which-pkg /usr/lib/libz.so.1
+$%s which-pkg '/usr/bin/*-config'
+`, w.name, w.name)
+}
+func (*whichPkg) Help(f *flag.FlagSet) {
+
+	fmt.Fprintf(f.Output(), "\nwhich-pkg flags are:\n")
+	f.PrintDefaults()
+}
+
+func (w *whichPkg) Run(ctx context.Context, args ...string) error {
+	if len(args) == 0 {
+		return commandLineErrorf("path must be supplied")
+	}
+
+	all, err := records(w.Sys)
+	if err != nil {
+		return err
+	}
+
+	missing := []string{}
+	for _, path := range args {
+		found := false
+		for _, sys := range sortedSystems(all) {
+			for _, r := range all[sys] {
+				for _, f := range r.Owns(path) {
+					fmt.Printf("%s: %s (carton %s, %s)\n", f.Path, r.Package, r.Carton, sys)
+					found = true
+				}
+			}
+		}
+		if !found {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("not shipped in any package: %s", strings.Join(missing, " "))
+	}
+	return nil
+}
+
+type pkgdata struct {
+	name   string //top cmd name
+	Sys    string `flag:"sys" help:"only show packages of system, e.g. arm-linux-gnueabi"`
+	Carton string `flag:"carton" help:"list packages produced by carton"`
+	Files  bool   `flag:"files" help:"list files shipped in package"`
+}
+
+func (*pkgdata) Name() string { return "pkgdata" }
+func (*pkgdata) Summary() string {
+	return "show data of packages recorded by packaging"
+}
+func (p *pkgdata) UsageLine() string {
+	return fmt.Sprintf(`[package...]
+
+without any argument, all packages are listed. package data is recorded
+under PKGDATADIR/<system> when carton is packaged.
+
+example:
+
+$%s pkgdata -files zlib
+$%s pkgdata -carton busybox
+`, p.name, p.name)
+}
+func (*pkgdata) Help(f *flag.FlagSet) {
+
+	fmt.Fprintf(f.Output(), "\npkgdata flags are:\n")
+	f.PrintDefaults()
+}
+
+func (p *pkgdata) Run(ctx context.Context, args ...string) error {
+
+	all, err := records(p.Sys)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	missing := map[string]bool{}
+	for _, name := range args {
+		wanted[name] = true
+		missing[name] = true
+	}
+
+	for _, sys := range sortedSystems(all) {
+		for _, r := range all[sys] {
+			if p.Carton != "" && r.Carton != p.Carton {
+				continue
+			}
+			if len(wanted) > 0 && !wanted[r.Package] {
+				continue
+			}
+
+			if len(wanted) == 0 && !p.Files {
+				fmt.Printf("%s %s %s (carton %s, %s)\n", r.Package, r.Version, r.Arch,
+					r.Carton, sys)
+				continue
+			}
+			p.show(sys, r)
+			delete(missing, r.Package)
+		}
+	}
+
+	for _, name := range args {
+		if missing[name] {
+			fmt.Printf("%s: no package data\n", name)
+		}
+	}
+	return nil
+}
+
+func (p *pkgdata) show(sys string, r *pkg.Record) {
+
+	fmt.Printf("Package: %s\n", r.Package)
+	fmt.Printf("Carton: %s\n", r.Carton)
+	fmt.Printf("Version: %s\n", r.Version)
+	fmt.Printf("Architecture: %s\n", r.Arch)
+	fmt.Printf("System: %s\n", sys)
+
+	for _, v := range []struct {
+		field string
+		list  []string
+	}{
+		{"Depends", r.Depends},
+		{"Sonames", r.Sonames},
+		{"Needed", r.Needed},
+	} {
+		if len(v.list) > 0 {
+			fmt.Printf("%s: %s\n", v.field, strings.Join(v.list, ", "))
+		}
+	}
+	for _, alt := range r.Alternatives {
+		fmt.Printf("Alternative: %s %s -> %s (%d)\n", alt.Name, alt.Link, alt.Target,
+			alt.Priority)
+	}
+
+	if p.Files {
+		var total int64
+		for _, f := range r.Files {
+			total += f.Size
+		}
+		fmt.Printf("Files: %d, %d bytes\n", len(r.Files), total)
+		for _, f := range r.Files {
+			if f.Link != "" {
+				fmt.Printf("  %s %10d %s -> %s\n", f.Mode, f.Size, f.Path, f.Link)
+			} else {
+				fmt.Printf("  %s %10d %s\n", f.Mode, f.Size, f.Path)
+			}
+		}
+	}
+	fmt.Println()
+}
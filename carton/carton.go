@@ -9,9 +9,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 
 	"skygo/fetch"
 	"skygo/pkg"
@@ -43,16 +45,26 @@ const (
 type Carton struct {
 	Desc     string // oneline description
 	Homepage string // home page
+	License  string // license expression, e.g. "GPL-2.0-only | MIT"
 
 	name    string
 	cartons []string
 
-	file      []string // which files offer this carton
-	srcdir    string   // path(dir) of Source code, value of var S
-	filespath []string // search dirs for scheme file://
+	file      []string  // which files offer this carton
+	line      int       // line of file[0] where carton is described, 0 if unknown
+	srcdir    string    // path(dir) of Source code, value of var S
+	filespath []string  // search dirs for scheme file://
+	problems  []Problem // found when carton is described, reported by Lint
+
+	classes  []string // inherited classes
+	licFiles []string // license files with checksum, refer to LicFiles
 
 	depends      []string // needed for both running and building
 	buildDepends []string // only needed when building from scratch
+	variants     []string // supported variants besides target and native
+
+	forVersions []forVersion // blocks of ForVersion
+	forApplied  int          // how many blocks are applied
 
 	fetch   *fetch.Resource
 	runbook *runbook.Runbook
@@ -60,14 +72,23 @@ type Carton struct {
 	runbook.KV // embed key-value
 
 	pkg.Packages // packager
+
+	variantPkgs sync.Map // packages of variant being packaged, refer to packages
 }
 
 // NewCarton create a carton and add to inventory
 func NewCarton(name string, m func(c *Carton)) {
 
+	_, file, line, _ := runtime.Caller(1)
+	newCarton(name, file, line, m)
+}
+
+// newCarton create a carton described by @file at @line and add to inventory
+func newCarton(name, file string, line int, m func(c *Carton)) {
+
 	c := new(Carton)
 	c.name = name
-	_, file, _, _ := runtime.Caller(1)
+	c.line = line
 
 	c.Init(file, c, func(arg Modifier) {
 
@@ -86,13 +107,53 @@ func NewCarton(name string, m func(c *Carton)) {
 				})
 		})
 
+		// license files are verified whenever code is fetched
+		fetch.AddTask(50, func(ctx runbook.Context) error {
+			return c.verifyLicenses(ctx)
+		})
+
 		fetch.InsertAfter(PATCH).Summary("Locates patch files and applies them to the source code").
 			InsertAfter(PREPARE).Summary("Prepares something for build").
 			InsertAfter(BUILD).Summary("Compiles the source in the compilation directory").
 			InsertAfter(INSTALL).Summary("Installs files from the compilation directory").
 			InsertAfter(PACKAGE).Summary("Packages files from the installation directory").
 			AddTask(0, func(ctx runbook.Context) error {
-				return c.Package(ctx.GetStr("D"), ctx.GetStr("PKGD"))
+				// carton's runtime depends go to its main package
+				// optional depends are only recommended
+				pkgs := c.packages(ctx, true)
+				main := pkgs.GetPkg(c.name)
+				for _, spec := range c.Depends() {
+					d, err := ParseDependency(spec)
+					if err != nil {
+						return err
+					}
+					if d.Host() {
+						continue
+					}
+					rel, err := d.Relation(ctxVariant(ctx))
+					switch {
+					case err == ErrNotFound && d.Optional:
+					case err != nil:
+						return fmt.Errorf("dependency %s: %s", spec, err)
+					case d.Optional:
+						main.Recommends(rel)
+					default:
+						main.Depends(rel)
+					}
+				}
+				return pkgs.Package(ctx, ctx.GetStr("D"), ctx.GetStr("PKGD"), c.control(ctx))
+			}).
+			AddTask(50, func(ctx runbook.Context) error {
+				return c.packages(ctx, false).QA(ctx, ctx.GetStr("D"), ctx.GetStr("PKGD"))
+			}).
+			AddTask(100, func(ctx runbook.Context) error {
+				// host variant, e.g. native, is only used for building, don't deploy it
+				if ctx.Get("ISNATIVE").(bool) {
+					return nil
+				}
+				return c.packages(ctx, false).Pack(ctx.GetStr("PKGD"),
+					filepath.Join(ctx.GetStr("FEEDDIR"), ctx.GetStr("TARGETARCH")),
+					c.control(ctx))
 			})
 
 		c.runbook = rb
@@ -116,14 +177,52 @@ func (c *Carton) Init(file string, arg Modifier, modify func(arg Modifier)) {
 		c.KV.Init(c.name)
 		c.Set("CN", c.name) //CN: carton name. By default, CN is the same as PN(c.name, provider name)
 
-		// create two packages: provider, provider-dev
+		// create packages: provider, provider-dev and standard split packages
 		c.NewPkg(c.name)
 		c.NewPkg(c.name + "-dev")
+		c.NewPkg(c.name + pkg.DBG)
+		c.NewPkg(c.name + pkg.STATICDEV)
+		c.NewPkg(c.name + pkg.DOC)
+		c.NewPkg(c.name + pkg.LOCALE)
 
 		modify(arg)
 	})
 }
 
+// packages returns packages of carton for variant of @ctx. each variant is
+// packaged with its own copy of packages, whose names are carton names of
+// variant, e.g. lib32-zlib-dev. copy is renewed if @fresh
+func (c *Carton) packages(ctx runbook.Context, fresh bool) *pkg.Packages {
+
+	v := ctxVariant(ctx)
+	if p, ok := c.variantPkgs.Load(v.name); ok && !fresh {
+		return p.(*pkg.Packages)
+	}
+	p := c.Clone(v.Of)
+	c.variantPkgs.Store(v.name, p)
+	return p
+}
+
+// control returns control fields shared by all packages of carton
+func (c *Carton) control(ctx runbook.Context) pkg.Control {
+
+	_, ver := c.Resource().Selected()
+	return pkg.Control{
+		Version:      ver,
+		Revision:     ctx.GetStr("PR"),
+		Epoch:        ctx.GetStr("PE"),
+		Architecture: ctx.GetStr("TARGETARCH"),
+		Maintainer:   ctx.GetStr("MAINTAINER"),
+		Description:  c.Desc,
+		Homepage:     c.Homepage,
+		License:      c.License,
+		LicenseDir:   licenseDir(ctx, c.licFiles),
+		Source:       ctxVariant(ctx).Of(c.name),
+
+		Sources: c.Resource().Sources(ctx),
+	}
+}
+
 // Provider return what's provided
 func (c *Carton) Provider() string {
 	return c.name
@@ -149,7 +248,13 @@ func (c *Carton) From(file ...string) []string {
 			if notAdded(from) {
 				c.file = append(c.file, from)
 				filepath := strings.TrimSuffix(from, ".go")
-				c.filespath = append(c.filespath, filepath)
+				for _, suffix := range []string{cartonSuffix, appendSuffix} {
+					filepath = strings.TrimSuffix(filepath, suffix)
+				}
+				// carton file and its append file may share files path
+				if len(c.filespath) == 0 || c.filespath[len(c.filespath)-1] != filepath {
+					c.filespath = append(c.filespath, filepath)
+				}
 			}
 		}
 	}
@@ -158,8 +263,8 @@ func (c *Carton) From(file ...string) []string {
 }
 
 // BuildDepends add depends only required for building from scratch
-// dep format: cartonName or carton group
-// carton group is a collection of cartonName with delimiter space
+// dep format: dependency or dependency group, refer to Dependency
+// dependency group is a collection of dependency with delimiter space
 // Always return the same kind of depends
 func (c *Carton) BuildDepends(deps ...string) []string {
 
@@ -167,7 +272,7 @@ func (c *Carton) BuildDepends(deps ...string) []string {
 		return c.buildDepends
 	}
 	for _, dep := range deps {
-		for _, d := range strings.Fields(dep) {
+		for _, d := range splitDepends(dep) {
 			c.buildDepends = append(c.buildDepends, d)
 		}
 	}
@@ -175,8 +280,8 @@ func (c *Carton) BuildDepends(deps ...string) []string {
 }
 
 // Depends add depends required for building from scratch, running or both
-// dep format: cartonName or carton group
-// carton group is a collection of cartonName with delimiter space
+// dep format: dependency or dependency group, refer to Dependency
+// dependency group is a collection of dependency with delimiter space
 // Always return the same kind of depends
 func (c *Carton) Depends(deps ...string) []string {
 
@@ -184,13 +289,69 @@ func (c *Carton) Depends(deps ...string) []string {
 		return c.depends
 	}
 	for _, dep := range deps {
-		for _, d := range strings.Fields(dep) {
+		for _, d := range splitDepends(dep) {
 			c.depends = append(c.depends, d)
 		}
 	}
 	return c.depends
 }
 
+// Variants adds variants which carton supports besides target, refer to
+// Variant. native is supported by default
+// Always return all supported variants except target
+func (c *Carton) Variants(name ...string) []string {
+
+	for _, n := range name {
+		if n == TargetVariant || n == NativeVariant {
+			continue
+		}
+		added := false
+		for _, v := range c.variants {
+			added = added || v == n
+		}
+		if !added {
+			c.variants = append(c.variants, n)
+		}
+	}
+	return append([]string{NativeVariant}, c.variants...)
+}
+
+// forVersion is block of ForVersion
+type forVersion struct {
+	pattern string
+	m       func(Modifier)
+}
+
+// ForVersion modifies carton in callback @m only when its selected version
+// matches glob @pattern, e.g. "2.*", refer to path.Match. carton without
+// version never applies it
+// blocks are applied in order after carton and all its updates, so
+// dependencies, variables and tasks added by them are used to validate
+// dependencies, detect loop and build carton. version selection can't be
+// changed in them
+func (c *Carton) ForVersion(pattern string, m func(Modifier)) {
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		panic(fmt.Sprintf("Carton Err: %s: version pattern %s: %s", c.name, pattern, err))
+	}
+	c.forVersions = append(c.forVersions, forVersion{pattern: pattern, m: m})
+}
+
+// applyForVersions applies blocks of ForVersion matching selected version to
+// carton @m, including blocks added by them
+func (c *Carton) applyForVersions(m Modifier) {
+
+	_, ver := c.fetch.Selected()
+	for c.forApplied < len(c.forVersions) {
+		b := c.forVersions[c.forApplied]
+		c.forApplied++
+		if matched, _ := path.Match(b.pattern, ver); matched && ver != "" {
+			log.Trace("Apply block of version %s to %s %s", b.pattern, c.name, ver)
+			b.m(m)
+		}
+	}
+}
+
 // SrcDir return where source code is under WORKDIR
 // WORKDIR depends on ARCH. one carton has different WORKDIR for different ARCH
 func (c *Carton) SrcDir(wd string) string {
@@ -250,16 +411,48 @@ func (c *Carton) AddFilePath(dir string) error {
 	if filepath.IsAbs(dir) {
 		return ErrAbsPath
 	}
-	_, file, _, _ := runtime.Caller(1)
+	_, file, line, _ := runtime.Caller(1)
 	dir = filepath.Join(filepath.Dir(file), dir)
 	_, e := os.Stat(dir)
 	if e == nil {
 
 		c.filespath = append(c.filespath, dir)
+	} else {
+		c.problems = append(c.problems, Problem{Carton: c.name, File: file, Line: line,
+			Check: "filespath", Message: fmt.Sprintf("%s doesn't exist", dir)})
 	}
 	return e
 }
 
+// Override sets value of @key if @when is satisfied, refer to
+// runbook.KVOverrider. invalid @when is reported by Lint too
+func (c *Carton) Override(when, key string, value interface{}) error {
+	return c.badOverride(c.KV.Override(when, key, value))
+}
+
+// Append appends @value to @key if @when is satisfied, refer to
+// runbook.KVOverrider. invalid @when is reported by Lint too
+func (c *Carton) Append(when, key, value string) error {
+	return c.badOverride(c.KV.Append(when, key, value))
+}
+
+// Prepend prepends @value to @key if @when is satisfied, refer to
+// runbook.KVOverrider. invalid @when is reported by Lint too
+func (c *Carton) Prepend(when, key, value string) error {
+	return c.badOverride(c.KV.Prepend(when, key, value))
+}
+
+// badOverride records error @err of override where it's made for Lint
+func (c *Carton) badOverride(err error) error {
+
+	if err != nil {
+		_, file, line, _ := runtime.Caller(2)
+		c.problems = append(c.problems, Problem{Carton: c.name, File: file, Line: line,
+			Check: "override", Message: err.Error()})
+	}
+	return err
+}
+
 // FilesPath return FilePath
 func (c *Carton) FilesPath() []string {
 	return c.filespath
@@ -297,6 +490,10 @@ func (c *Carton) String() string {
 		fmt.Fprintf(&b, "%s\n", c.Homepage)
 	}
 
+	if c.License != "" {
+		fmt.Fprintf(&b, "License: %s\n", c.License)
+	}
+
 	if len(c.cartons) > 0 {
 		fmt.Fprintf(&b, "Provids: %s", c.cartons[0])
 		for _, p := range c.cartons[1:] {
@@ -305,6 +502,13 @@ func (c *Carton) String() string {
 		fmt.Fprintf(&b, "\n")
 	}
 
+	if len(c.classes) > 0 {
+		fmt.Fprintf(&b, "Classes: %s\n", strings.Join(c.classes, " "))
+	}
+
+	fmt.Fprintf(&b, "Variant: %s\n", strings.Join(append([]string{TargetVariant},
+		c.Variants()...), " "))
+
 	// where come from
 	if len(c.file) > 0 {
 		fmt.Fprintf(&b, "   From: %s\n", c.file[0])
@@ -0,0 +1,174 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"skygo/runbook"
+)
+
+// ClassWeight is weight of tasks added by class to stage prepare, build and
+// install. class replaces task of ClassWeight in the same stage, e.g. added
+// by class inherited before, so carton can inherit several classes, or the
+// same class again in ForVersion. carton can replace one of them by
+//
+//	c.Runbook().Stage(carton.BUILD).DelTask(carton.ClassWeight).AddTask(carton.ClassWeight, ...)
+//
+// or run its own tasks before or after it by lower or higher weight
+const ClassWeight = 0
+
+// classes holds all registered classes
+var (
+	classes  = make(map[string]func(m Modifier))
+	classesM sync.Mutex
+)
+
+// NewClass registers class @name, @class is called when carton inherits it.
+// it should delete task of ClassWeight before adding its own one, refer to
+// ClassWeight. builtin classes are autotools, cmake, meson, make, go and cargo
+func NewClass(name string, class func(m Modifier)) {
+
+	classesM.Lock()
+	defer classesM.Unlock()
+	if _, ok := classes[name]; ok {
+		panic(fmt.Sprintf("Carton Err: class %s had been added!", name))
+	}
+	classes[name] = class
+}
+
+// Classes returns names of all classes, sorted by name
+func Classes() []string {
+
+	classesM.Lock()
+	defer classesM.Unlock()
+
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Inherit applies @class to carton in order, it panics if class is unknown
+func (c *Carton) Inherit(class ...string) {
+
+	for _, name := range class {
+
+		classesM.Lock()
+		f, ok := classes[name]
+		classesM.Unlock()
+		if !ok {
+			panic(fmt.Sprintf("Carton Err: %s inherits unknown class %s, candidates: %s",
+				c.name, name, strings.Join(Classes(), ", ")))
+		}
+		c.classes = append(c.classes, name)
+		f(c)
+	}
+}
+
+// toolchain returns environment of cross toolchain for context @ctx
+// target carton uses CROSS_COMPILE tools with --sysroot=SYSROOT and
+// TUNE_CCARGS, native carton uses host tools with headers and libraries of
+// SYSROOT. native tools staged in SYSROOT_NATIVE are found by PATH
+func toolchain(ctx runbook.Context) []string {
+
+	cross := ctx.GetStr("CROSS_COMPILE")
+	sysroot := ctx.GetStr("SYSROOT")
+	native := ctx.Get("ISNATIVE").(bool)
+
+	cc, cxx := cross+"gcc", cross+"g++"
+	cflags, ldflags := []string{}, []string{}
+	if native {
+		cflags = append(cflags, "-I"+filepath.Join(sysroot, "usr/include"))
+		ldflags = append(ldflags, "-L"+filepath.Join(sysroot, "usr/lib"),
+			"-Wl,-rpath-link,"+filepath.Join(sysroot, "usr/lib"))
+	} else {
+		flags := strings.TrimSpace(ctx.GetStr("TUNE_CCARGS") + " --sysroot=" + sysroot)
+		cc, cxx = cc+" "+flags, cxx+" "+flags
+	}
+
+	join := func(key string, values []string) string {
+		return strings.TrimSpace(strings.Join(append(values, ctx.GetStr(key)), " "))
+	}
+
+	env := []string{
+		"CC=" + cc,
+		"CXX=" + cxx,
+		"CPP=" + cc + " -E",
+		"LD=" + cross + "ld",
+		"AR=" + cross + "ar",
+		"AS=" + cross + "as",
+		"NM=" + cross + "nm",
+		"RANLIB=" + cross + "ranlib",
+		"STRIP=" + cross + "strip",
+		"OBJCOPY=" + cross + "objcopy",
+		"OBJDUMP=" + cross + "objdump",
+		"CFLAGS=" + join("CFLAGS", cflags),
+		"CXXFLAGS=" + join("CXXFLAGS", cflags),
+		"CPPFLAGS=" + join("CPPFLAGS", cflags),
+		"LDFLAGS=" + join("LDFLAGS", ldflags),
+	}
+
+	path := filepath.Join(ctx.GetStr("SYSROOT_NATIVE"), "usr/bin")
+	return append(env, "PATH="+path+":"+os.Getenv("PATH"))
+}
+
+// buildSys returns system triplet of building machine, e.g. x86_64-linux-gnu
+var buildSys = func() func() string {
+
+	var (
+		once sync.Once
+		sys  string
+	)
+	return func() string {
+		once.Do(func() {
+			if out, err := exec.Command("gcc", "-dumpmachine").Output(); err == nil {
+				sys = strings.TrimSpace(string(out))
+			}
+		})
+		return sys
+	}
+}()
+
+// classDirs returns SRC dir and build dir, if @separate is true and build dir
+// is the same as SRC dir, build dir is WORKDIR/build
+func classDirs(ctx runbook.Context, separate bool) (string, string) {
+
+	src, build := ctx.Dir()
+	if separate && build == src {
+		build = filepath.Join(ctx.GetStr("WORKDIR"), "build")
+	}
+	os.MkdirAll(build, 0755)
+	return src, build
+}
+
+// classRun runs command @name with toolchain environment and extra @env
+// under directory @dir
+func classRun(ctx runbook.Context, stage, dir string, env []string,
+	name string, args ...string) error {
+
+	cmd := runbook.NewCommand(ctx, name, args...)
+	cmd.Cmd.Env = append(append(cmd.Cmd.Env, toolchain(ctx)...), env...)
+	cmd.Cmd.Dir = dir
+	return cmd.Run(ctx, stage)
+}
+
+// fields splits value of @key with delimiter space, e.g. EXTRA_CONF
+func fields(ctx runbook.Context, key string) []string {
+	return strings.Fields(ctx.GetStr(key))
+}
+
+func jobs() string {
+	return fmt.Sprintf("-j%d", runtime.NumCPU())
+}
@@ -0,0 +1,34 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"reflect"
+	"testing"
+
+	"skygo/runbook"
+)
+
+func TestInheritClasses(t *testing.T) {
+
+	c := &Carton{name: "foo"}
+	c.runbook = runbook.NewRunbook()
+	c.runbook.PushFront(PREPARE).InsertAfter(BUILD).InsertAfter(INSTALL)
+	c.runbook.Stage(BUILD).AddTask(10, makeBuild)
+
+	// tasks of class inherited later replace the ones of ClassWeight
+	c.Inherit("autotools", "make")
+	c.Inherit("cmake")
+	c.Inherit("make")
+
+	for stage, want := range map[string]int{PREPARE: 1, BUILD: 2, INSTALL: 1} {
+		if n := c.runbook.Stage(stage).Len(); n != want {
+			t.Errorf("stage %s has %d tasks, want %d", stage, n, want)
+		}
+	}
+	if want := []string{"autotools", "make", "cmake", "make"}; !reflect.DeepEqual(c.classes, want) {
+		t.Errorf("classes = %v, want %v", c.classes, want)
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"skygo/runbook"
+	"skygo/utils"
+)
+
+/*
+Builtin classes add tasks to stage prepare, build and install with weight
+ClassWeight, replacing the ones of classes inherited before. They build in B if it's given, otherwise cmake, meson, go and
+cargo build in WORKDIR/build. All of them install into D with prefix /usr.
+
+Variables of carton:
+
+	EXTRA_CONF    extra arguments of configure, cmake or meson setup
+	EXTRA_MAKE    extra arguments of make, go build or cargo build
+	GO_PACKAGES   packages built by class go, default is ./...
+	RUST_TARGET   target triple of class cargo, default is derived from TARGETARCH
+*/
+func init() {
+
+	NewClass("autotools", func(m Modifier) {
+		rb := m.Runbook()
+		rb.Stage(PREPARE).DelTask(ClassWeight).AddTask(ClassWeight, autotoolsConfigure)
+		rb.Stage(BUILD).DelTask(ClassWeight).AddTask(ClassWeight, makeBuild)
+		rb.Stage(INSTALL).DelTask(ClassWeight).AddTask(ClassWeight, makeInstall)
+	})
+
+	NewClass("make", func(m Modifier) {
+		rb := m.Runbook()
+		rb.Stage(BUILD).DelTask(ClassWeight).AddTask(ClassWeight, makeBuild)
+		rb.Stage(INSTALL).DelTask(ClassWeight).AddTask(ClassWeight, makeInstall)
+	})
+
+	NewClass("cmake", func(m Modifier) {
+		rb := m.Runbook()
+		rb.Stage(PREPARE).DelTask(ClassWeight).AddTask(ClassWeight, cmakeConfigure)
+		rb.Stage(BUILD).DelTask(ClassWeight).AddTask(ClassWeight, func(ctx runbook.Context) error {
+			_, build := classDirs(ctx, true)
+			return classRun(ctx, BUILD, build, nil, "cmake", "--build", ".", "--", jobs())
+		})
+		rb.Stage(INSTALL).DelTask(ClassWeight).AddTask(ClassWeight, func(ctx runbook.Context) error {
+			_, build := classDirs(ctx, true)
+			return classRun(ctx, INSTALL, build, []string{"DESTDIR=" + ctx.GetStr("D")},
+				"cmake", "--build", ".", "--target", "install")
+		})
+	})
+
+	NewClass("meson", func(m Modifier) {
+		rb := m.Runbook()
+		rb.Stage(PREPARE).DelTask(ClassWeight).AddTask(ClassWeight, mesonConfigure)
+		rb.Stage(BUILD).DelTask(ClassWeight).AddTask(ClassWeight, func(ctx runbook.Context) error {
+			_, build := classDirs(ctx, true)
+			return classRun(ctx, BUILD, build, nil, "ninja", jobs())
+		})
+		rb.Stage(INSTALL).DelTask(ClassWeight).AddTask(ClassWeight, func(ctx runbook.Context) error {
+			_, build := classDirs(ctx, true)
+			return classRun(ctx, INSTALL, build, []string{"DESTDIR=" + ctx.GetStr("D")},
+				"ninja", "install")
+		})
+	})
+
+	NewClass("go", func(m Modifier) {
+		rb := m.Runbook()
+		rb.Stage(BUILD).DelTask(ClassWeight).AddTask(ClassWeight, goBuild)
+		rb.Stage(INSTALL).DelTask(ClassWeight).AddTask(ClassWeight, func(ctx runbook.Context) error {
+			_, build := classDirs(ctx, true)
+			return installExecutables(filepath.Join(build, "bin"),
+				filepath.Join(ctx.GetStr("D"), "usr/bin"))
+		})
+	})
+
+	NewClass("cargo", func(m Modifier) {
+		rb := m.Runbook()
+		rb.Stage(BUILD).DelTask(ClassWeight).AddTask(ClassWeight, cargoBuild)
+		rb.Stage(INSTALL).DelTask(ClassWeight).AddTask(ClassWeight, func(ctx runbook.Context) error {
+			_, build := classDirs(ctx, true)
+			release := filepath.Join(build, "release")
+			if !ctx.Get("ISNATIVE").(bool) {
+				target, err := rustTarget(ctx)
+				if err != nil {
+					return err
+				}
+				release = filepath.Join(build, target, "release")
+			}
+			return installExecutables(release, filepath.Join(ctx.GetStr("D"), "usr/bin"))
+		})
+	})
+}
+
+// arch describes how TARGETARCH is named by other build systems
+type arch struct {
+	goarch    string
+	cpuFamily string // meson
+	rust      string
+	bigEndian bool
+}
+
+var arches = map[string]arch{
+	"arm":         {"arm", "arm", "armv7-unknown-linux-gnueabihf", false},
+	"armeb":       {"", "arm", "", true},
+	"aarch64":     {"arm64", "aarch64", "aarch64-unknown-linux-gnu", false},
+	"arm64":       {"arm64", "aarch64", "aarch64-unknown-linux-gnu", false},
+	"i386":        {"386", "x86", "i686-unknown-linux-gnu", false},
+	"i486":        {"386", "x86", "i686-unknown-linux-gnu", false},
+	"i586":        {"386", "x86", "i686-unknown-linux-gnu", false},
+	"i686":        {"386", "x86", "i686-unknown-linux-gnu", false},
+	"x86_64":      {"amd64", "x86_64", "x86_64-unknown-linux-gnu", false},
+	"mips":        {"mips", "mips", "mips-unknown-linux-gnu", true},
+	"mipsel":      {"mipsle", "mips", "mipsel-unknown-linux-gnu", false},
+	"mips64":      {"mips64", "mips64", "mips64-unknown-linux-gnuabi64", true},
+	"mips64el":    {"mips64le", "mips64", "mips64el-unknown-linux-gnuabi64", false},
+	"powerpc":     {"", "ppc", "powerpc-unknown-linux-gnu", true},
+	"powerpc64":   {"ppc64", "ppc64", "powerpc64-unknown-linux-gnu", true},
+	"powerpc64le": {"ppc64le", "ppc64", "powerpc64le-unknown-linux-gnu", false},
+	"riscv64":     {"riscv64", "riscv64", "riscv64gc-unknown-linux-gnu", false},
+}
+
+func autotoolsConfigure(ctx runbook.Context) error {
+
+	src, build := classDirs(ctx, false)
+
+	if !utils.IsExist(filepath.Join(src, "configure")) {
+		if err := classRun(ctx, PREPARE, src, nil, "autoreconf", "-fi"); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"--prefix=/usr", "--sysconfdir=/etc", "--localstatedir=/var"}
+	if !ctx.Get("ISNATIVE").(bool) {
+		args = append(args, "--host="+ctx.GetStr("TARGETSYS"))
+		if sys := buildSys(); sys != "" {
+			args = append(args, "--build="+sys)
+		}
+	}
+	// cross tools run on building machine and generate code for target
+	if ctx.GetStr("VARIANT") == CrossVariant {
+		args = append(args, "--target="+ctx.GetStr("TARGETSYS"))
+	}
+	args = append(args, fields(ctx, "EXTRA_CONF")...)
+	return classRun(ctx, PREPARE, build, nil, filepath.Join(src, "configure"), args...)
+}
+
+func makeBuild(ctx runbook.Context) error {
+
+	_, build := classDirs(ctx, false)
+	args := append([]string{jobs(), "CROSS_COMPILE=" + ctx.GetStr("CROSS_COMPILE")},
+		fields(ctx, "EXTRA_MAKE")...)
+	return classRun(ctx, BUILD, build, nil, "make", args...)
+}
+
+func makeInstall(ctx runbook.Context) error {
+
+	_, build := classDirs(ctx, false)
+	args := append([]string{"install", "DESTDIR=" + ctx.GetStr("D"),
+		"prefix=/usr", "PREFIX=/usr", "CROSS_COMPILE=" + ctx.GetStr("CROSS_COMPILE")},
+		fields(ctx, "EXTRA_MAKE")...)
+	return classRun(ctx, INSTALL, build, nil, "make", args...)
+}
+
+func cmakeConfigure(ctx runbook.Context) error {
+
+	src, build := classDirs(ctx, true)
+	sysroot := ctx.GetStr("SYSROOT")
+
+	args := []string{src, "-DCMAKE_INSTALL_PREFIX=/usr", "-DCMAKE_BUILD_TYPE=Release"}
+	if ctx.Get("ISNATIVE").(bool) {
+		args = append(args, "-DCMAKE_PREFIX_PATH="+filepath.Join(sysroot, "usr"))
+	} else {
+		cross := ctx.GetStr("CROSS_COMPILE")
+		toolchain := fmt.Sprintf(`set(CMAKE_SYSTEM_NAME Linux)
+set(CMAKE_SYSTEM_PROCESSOR %s)
+set(CMAKE_C_COMPILER %sgcc)
+set(CMAKE_CXX_COMPILER %sg++)
+set(CMAKE_C_FLAGS_INIT "%s")
+set(CMAKE_CXX_FLAGS_INIT "%s")
+set(CMAKE_SYSROOT %s)
+set(CMAKE_FIND_ROOT_PATH %s)
+set(CMAKE_FIND_ROOT_PATH_MODE_PROGRAM NEVER)
+set(CMAKE_FIND_ROOT_PATH_MODE_LIBRARY ONLY)
+set(CMAKE_FIND_ROOT_PATH_MODE_INCLUDE ONLY)
+set(CMAKE_FIND_ROOT_PATH_MODE_PACKAGE ONLY)
+set(CMAKE_PROGRAM_PATH %s)
+`, ctx.GetStr("TARGETARCH"), cross, cross, ctx.GetStr("TUNE_CCARGS"),
+			ctx.GetStr("TUNE_CCARGS"), sysroot, sysroot,
+			filepath.Join(ctx.GetStr("SYSROOT_NATIVE"), "usr/bin"))
+
+		file := filepath.Join(ctx.GetStr("WORKDIR"), "toolchain.cmake")
+		if err := ioutil.WriteFile(file, []byte(toolchain), 0644); err != nil {
+			return err
+		}
+		args = append(args, "-DCMAKE_TOOLCHAIN_FILE="+file)
+	}
+	args = append(args, fields(ctx, "EXTRA_CONF")...)
+	return classRun(ctx, PREPARE, build, nil, "cmake", args...)
+}
+
+func mesonConfigure(ctx runbook.Context) error {
+
+	src, build := classDirs(ctx, true)
+
+	args := []string{"setup", "--prefix=/usr", "--buildtype=release"}
+	if !ctx.Get("ISNATIVE").(bool) {
+
+		target := ctx.GetStr("TARGETARCH")
+		a, ok := arches[target]
+		if !ok {
+			a = arch{cpuFamily: target}
+		}
+		endian := "little"
+		if a.bigEndian {
+			endian = "big"
+		}
+
+		quote := func(args ...string) string {
+			for i, arg := range args {
+				args[i] = "'" + strings.Replace(arg, "'", `\'`, -1) + "'"
+			}
+			return "[" + strings.Join(args, ", ") + "]"
+		}
+		cross, sysroot := ctx.GetStr("CROSS_COMPILE"), ctx.GetStr("SYSROOT")
+		flags := append(fields(ctx, "TUNE_CCARGS"), "--sysroot="+sysroot)
+
+		file := fmt.Sprintf(`[binaries]
+c = %s
+cpp = %s
+ar = '%sar'
+strip = '%sstrip'
+pkgconfig = 'pkg-config'
+
+[properties]
+sys_root = '%s'
+
+[host_machine]
+system = 'linux'
+cpu_family = '%s'
+cpu = '%s'
+endian = '%s'
+`, quote(append([]string{cross + "gcc"}, flags...)...),
+			quote(append([]string{cross + "g++"}, flags...)...),
+			cross, cross, sysroot, a.cpuFamily, target, endian)
+
+		path := filepath.Join(ctx.GetStr("WORKDIR"), "meson.cross")
+		if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+			return err
+		}
+		args = append(args, "--cross-file", path)
+	}
+	args = append(args, fields(ctx, "EXTRA_CONF")...)
+	args = append(args, build, src)
+
+	// reconfigure if build dir had been set up
+	if utils.IsExist(filepath.Join(build, "build.ninja")) {
+		args = append(args[:1], append([]string{"--reconfigure"}, args[1:]...)...)
+	}
+	return classRun(ctx, PREPARE, ctx.GetStr("WORKDIR"), nil, "meson", args...)
+}
+
+// goEnv returns GOOS, GOARCH etc. for context
+func goEnv(ctx runbook.Context) []string {
+
+	goarch := ctx.GetStr("TARGETARCH")
+	if a, ok := arches[goarch]; ok && a.goarch != "" {
+		goarch = a.goarch
+	}
+
+	wd := ctx.GetStr("WORKDIR")
+	env := []string{
+		"GOOS=" + ctx.GetStr("TARGETOS"),
+		"GOARCH=" + goarch,
+		"GOPATH=" + filepath.Join(wd, "go"),
+		"GOCACHE=" + filepath.Join(wd, "go-build"),
+	}
+	if ctx.Get("CGO_ENABLED") == nil {
+		env = append(env, "CGO_ENABLED=0")
+	}
+	return env
+}
+
+func goBuild(ctx runbook.Context) error {
+
+	src, build := classDirs(ctx, true)
+	bin := filepath.Join(build, "bin")
+	os.MkdirAll(bin, 0755)
+
+	packages := fields(ctx, "GO_PACKAGES")
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+
+	// flag -trimpath requires go 1.13, trim SRC dir by compiler and assembler
+	args := append([]string{"build", "-gcflags=all=-trimpath=" + src,
+		"-asmflags=all=-trimpath=" + src, "-o", bin + "/"},
+		fields(ctx, "EXTRA_MAKE")...)
+	return classRun(ctx, BUILD, src, goEnv(ctx), "go", append(args, packages...)...)
+}
+
+// rustTarget returns target triple of Rust, RUST_TARGET wins
+func rustTarget(ctx runbook.Context) (string, error) {
+
+	if target := ctx.GetStr("RUST_TARGET"); target != "" {
+		return target, nil
+	}
+	if a, ok := arches[ctx.GetStr("TARGETARCH")]; ok && a.rust != "" {
+		return a.rust, nil
+	}
+	return "", fmt.Errorf("no Rust target for %s, set RUST_TARGET",
+		ctx.GetStr("TARGETARCH"))
+}
+
+func cargoBuild(ctx runbook.Context) error {
+
+	src, build := classDirs(ctx, true)
+
+	args := []string{"build", "--release", "--target-dir", build}
+	env := []string{}
+	if !ctx.Get("ISNATIVE").(bool) {
+		target, err := rustTarget(ctx)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--target", target)
+
+		linker := strings.ToUpper(strings.Replace(target, "-", "_", -1))
+		env = append(env,
+			"CARGO_TARGET_"+linker+"_LINKER="+ctx.GetStr("CROSS_COMPILE")+"gcc",
+			"PKG_CONFIG_ALLOW_CROSS=1")
+	}
+	args = append(args, fields(ctx, "EXTRA_MAKE")...)
+	return classRun(ctx, BUILD, src, env, "cargo", args...)
+}
+
+// installExecutables copies executables under @from to @to, files having
+// extension are skipped, e.g. lib*.so
+func installExecutables(from, to string) error {
+
+	infos, err := ioutil.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(to, 0755)
+
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || info.Mode()&0111 == 0 ||
+			strings.Contains(info.Name(), ".") {
+			continue
+		}
+		f, err := os.Open(filepath.Join(from, info.Name()))
+		if err != nil {
+			return err
+		}
+		err = utils.CopyFile(filepath.Join(to, info.Name()), 0755, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
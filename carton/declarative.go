@@ -0,0 +1,675 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"skygo/pkg"
+	"skygo/utils/log"
+	"skygo/utils/toml"
+)
+
+// suffix of declarative carton files
+const (
+	cartonSuffix = ".carton.toml" // defines new carton
+	appendSuffix = ".append.toml" // updates carton like Update
+)
+
+// weight of stage script in declarative file, it runs after builtin task of
+// stage whose weight is 0
+const scriptWeight = 10
+
+// declStages are stages which declarative file can add script to
+var declStages = []string{SYSROOT, FETCH, PATCH, PREPARE, BUILD, INSTALL, PACKAGE}
+
+/*
+Declarative carton is described by TOML file <name>.carton.toml, and updated
+by <name>.append.toml. Both are discovered from layer directories. Files
+under directory <name> beside them are found by scheme file:// and script
+tasks. Example:
+
+	name = "zlib"           # optional, default is file name
+	description = "General purpose data compression library"
+	homepage = "https://zlib.net"
+	license = "Zlib"        # license expression
+	license-files = ["zlib.h;beginline=6;endline=23;md5=<md5>"]
+	provides = ["libz"]     # virtual cartons
+	depends = ["busybox"]
+	build-depends = ["make-native"]
+	variants = ["nativesdk"] # besides target and native, refer to Variant
+	prefer = "1.2.11"       # preferred version
+	srcdir = "zlib-1.2.11"  # relative to WORKDIR or to file
+	inherit = ["autotools"] # classes, refer to NewClass
+
+	[versions]
+	"1.2.11" = ["https://zlib.net/zlib-1.2.11.tar.gz#<sha256>"]
+
+	[vars]
+	PR = "r1"
+
+	# script of stage, it runs after builtin task and class task of stage
+	[stages]
+	install = "rm -rf ${D}/usr/share/man"
+
+	# independent task force
+	[tasks.menuconfig]
+	summary = "Configure by menu"
+	script = "make menuconfig"
+
+	# applied only when selected version matches glob, it has keys srcdir,
+	# depends, build-depends, inherit, vars, stages and tasks
+	[for-version."1.3*"]
+	depends = ["busybox (>= 1.30)"]
+	vars = { EXTRA_CONF = "--static" }
+
+	[packages.zlib-utils]
+	files = ["usr/bin/*"]   # shipped before default packages, e.g. zlib
+	depends = ["zlib"]      # recommends, conflicts, replaces, provides and
+	conffiles = []          # conffiles are lists too
+	allow-empty = true
+	scripts = { postinst = "ldconfig" }
+	alternatives = [
+		{ name = "minigzip", link = "/usr/bin/gzip", target = "/usr/bin/minigzip", priority = 10 },
+	]
+
+append file has the same keys except provides, name defaults to file name
+too. lists are appended, others are overwritten including stage scripts
+*/
+
+// declaration holds one declarative carton or append file
+type declaration struct {
+	file     string
+	isAppend bool
+
+	name     string
+	desc     *string
+	homepage *string
+	license  *string
+	srcdir   string
+	prefer   string
+
+	provides     []string
+	depends      []string
+	buildDepends []string
+	inherit      []string
+	licFiles     []string
+	variants     []string
+
+	versions    []declVersion
+	vars        map[string]interface{}
+	stages      []declScript
+	tasks       []declTask
+	packages    []*declPkg
+	forVersions []declForVersion
+}
+
+// declForVersion is block applied by ForVersion
+type declForVersion struct {
+	pattern string
+	decl    *declaration
+}
+
+type declVersion struct {
+	version string
+	srcurl  []string
+}
+
+type declScript struct {
+	stage  string
+	script string
+	pos    toml.Position
+}
+
+type declTask struct {
+	name    string
+	summary string
+	script  string
+}
+
+type declPkg struct {
+	name string
+
+	files      []string
+	depends    []string
+	recommends []string
+	conflicts  []string
+	replaces   []string
+	provides   []string
+	conffiles  []string
+
+	allowEmpty   bool
+	scripts      map[string]string
+	alternatives []pkg.Alternative
+}
+
+// LoadLayers discovers declarative cartons under layer directories @dirs,
+// and adds them into inventory. each directory is registered as a layer,
+// refer to Layer. It must be called before BuildInventory.
+// All carton files are added before any append file is applied, so append
+// file can update carton from any layer
+func LoadLayers(dirs ...string) error {
+
+	cartons, appends := []string{}, []string{}
+	for _, dir := range dirs {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if err := loadLayer(dir); err != nil {
+			return fmt.Errorf("layer %s: %s", dir, err)
+		}
+		if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			switch {
+			case info.IsDir():
+			case strings.HasSuffix(path, cartonSuffix):
+				cartons = append(cartons, path)
+			case strings.HasSuffix(path, appendSuffix):
+				appends = append(appends, path)
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("layer %s: %s", dir, err)
+		}
+	}
+
+	decls := []*declaration{}
+	for _, file := range append(cartons, appends...) {
+		d, err := parseDeclaration(file)
+		if err != nil {
+			return err
+		}
+		decls = append(decls, d)
+	}
+
+	for _, d := range decls {
+		if d.isAppend {
+			continue
+		}
+		if _, ok := inventory[d.name]; ok {
+			return fmt.Errorf("%s: carton %s had been added", d.file, d.name)
+		}
+
+		d := d
+		log.Trace("Add declarative carton %s from %s", d.name, d.file)
+		newCarton(d.name, d.file, 0, func(c *Carton) {
+			c.provide(d.file, d.provides...)
+			d.apply(c)
+		})
+	}
+
+	for _, d := range decls {
+		if !d.isAppend {
+			continue
+		}
+		if _, ok := inventory[d.name]; !ok {
+			return fmt.Errorf("%s: carton %s is not found for updating", d.file, d.name)
+		}
+
+		d := d
+		updateFrom(d.name, d.file, func(m Modifier) {
+			d.apply(m)
+		})
+	}
+	return nil
+}
+
+// apply configures carton @m by declaration
+func (d *declaration) apply(m Modifier) {
+
+	c := toCarton(m)
+	if d.desc != nil {
+		c.Desc = *d.desc
+	}
+	if d.homepage != nil {
+		c.Homepage = *d.homepage
+	}
+	if d.license != nil {
+		c.License = *d.license
+	}
+	if len(d.licFiles) > 0 {
+		m.LicFiles(d.licFiles...)
+	}
+	if d.srcdir != "" {
+		dir := d.srcdir
+		if r := filepath.Join(filepath.Dir(d.file), dir); !filepath.IsAbs(dir) &&
+			isDir(r) {
+			dir = r
+		}
+		c.srcdir = dir
+	}
+
+	if len(d.depends) > 0 {
+		m.Depends(d.depends...)
+	}
+	if len(d.buildDepends) > 0 {
+		m.BuildDepends(d.buildDepends...)
+	}
+	if len(d.variants) > 0 {
+		m.Variants(d.variants...)
+	}
+
+	for _, v := range d.versions {
+		src := m.Resource().ByVersion(v.version)
+		for _, url := range v.srcurl {
+			src.Push(url)
+		}
+	}
+	if d.prefer != "" {
+		m.Resource().Prefer(d.prefer)
+	}
+
+	keys := make([]string, 0, len(d.vars))
+	for key := range d.vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		m.Set(key, d.vars[key])
+	}
+
+	if len(d.inherit) > 0 {
+		m.Inherit(d.inherit...)
+	}
+
+	rb := m.Runbook()
+	for _, s := range d.stages {
+		stage := rb.Stage(s.stage)
+		if stage == nil {
+			panic(fmt.Sprintf("Carton Err: %s: carton %s has no stage %s", s.pos,
+				c.name, s.stage))
+		}
+		stage.DelTask(scriptWeight).AddTask(scriptWeight, s.script)
+	}
+	for _, t := range d.tasks {
+		rb.NewTaskForce(t.name, t.script, t.summary)
+	}
+
+	for _, fv := range d.forVersions {
+		fv := fv
+		m.ForVersion(fv.pattern, func(m Modifier) {
+			fv.decl.apply(m)
+		})
+	}
+
+	packager := m.Packager()
+	for _, dp := range d.packages {
+		// package with files is split package, its files are shipped before
+		// default packages, e.g. main package, claim them
+		p := packager.GetPkg(dp.name)
+		switch {
+		case len(dp.files) > 0:
+			p = packager.Split(dp.name, dp.files...)
+		case p == nil:
+			p = packager.NewPkg(dp.name)
+		}
+		for _, v := range []struct {
+			set  func(...string) []string
+			list []string
+		}{
+			{p.Depends, dp.depends},
+			{p.Recommends, dp.recommends},
+			{p.Conflicts, dp.conflicts},
+			{p.Replaces, dp.replaces},
+			{p.Provides, dp.provides},
+			{p.Conffiles, dp.conffiles},
+		} {
+			if len(v.list) > 0 {
+				v.set(v.list...)
+			}
+		}
+		if dp.allowEmpty {
+			p.AllowEmpty()
+		}
+		for kind, script := range dp.scripts {
+			p.Script(kind, script)
+		}
+		for _, alt := range dp.alternatives {
+			p.Alternative(alt.Name, alt.Link, alt.Target, alt.Priority)
+		}
+	}
+}
+
+// toCarton returns Carton embedded in @m
+func toCarton(m Modifier) *Carton {
+
+	switch c := m.(type) {
+	case *Carton:
+		return c
+	case *Image:
+		return &c.Carton
+	}
+	panic(fmt.Sprintf("Carton Err: unknown carton type %T", m))
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// decoder decodes values of TOML document with position in error
+type decoder struct {
+	doc *toml.Document
+	err error
+}
+
+func (d *decoder) errorf(path, format string, v ...interface{}) {
+
+	if d.err != nil {
+		return
+	}
+	pos, ok := d.doc.Positions[path]
+	if !ok {
+		pos = toml.Position{File: d.doc.Positions[""].File}
+	}
+	d.err = fmt.Errorf("%s: %s: %s", pos, path, fmt.Sprintf(format, v...))
+}
+
+// keys checks @table only has @allowed keys, and returns sorted keys
+func (d *decoder) keys(table map[string]interface{}, prefix string, allowed ...string) []string {
+
+	keys := []string{}
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if len(allowed) == 0 {
+		return keys
+	}
+	for _, key := range keys {
+		found := false
+		for _, a := range allowed {
+			if key == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			d.errorf(join(prefix, key), "unknown key, expected one of %s",
+				strings.Join(allowed, ", "))
+		}
+	}
+	return keys
+}
+
+func (d *decoder) str(table map[string]interface{}, prefix, key string) *string {
+
+	v, ok := table[key]
+	if !ok {
+		return nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		d.errorf(join(prefix, key), "expected string, got %T", v)
+		return nil
+	}
+	return &s
+}
+
+func (d *decoder) strOr(table map[string]interface{}, prefix, key string) string {
+	if s := d.str(table, prefix, key); s != nil {
+		return *s
+	}
+	return ""
+}
+
+// strs accepts array of strings or one string with delimiter space
+func (d *decoder) strs(table map[string]interface{}, prefix, key string) []string {
+
+	v, ok := table[key]
+	if !ok {
+		return nil
+	}
+
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		list := []string{}
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				d.errorf(join(prefix, key), "expected array of strings, got %T", e)
+				return nil
+			}
+			list = append(list, s)
+		}
+		return list
+	}
+	d.errorf(join(prefix, key), "expected array of strings, got %T", v)
+	return nil
+}
+
+func (d *decoder) table(table map[string]interface{}, prefix, key string) map[string]interface{} {
+
+	v, ok := table[key]
+	if !ok {
+		return nil
+	}
+	t, ok := v.(map[string]interface{})
+	if !ok {
+		d.errorf(join(prefix, key), "expected table, got %T", v)
+		return nil
+	}
+	return t
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// parseDeclaration parses declarative carton file or append file @file
+func parseDeclaration(file string) (*declaration, error) {
+
+	doc, err := toml.ParseFile(file)
+	if err != nil {
+		return nil, err
+	}
+	doc.Positions[""] = toml.Position{File: file}
+
+	decl := &declaration{
+		file:     file,
+		isAppend: strings.HasSuffix(file, appendSuffix),
+		vars:     make(map[string]interface{}),
+	}
+	d := &decoder{doc: doc}
+	root := doc.Root
+
+	allowed := []string{"name", "description", "homepage", "license",
+		"license-files", "srcdir", "prefer", "depends", "build-depends", "inherit",
+		"variants", "versions", "vars", "stages", "tasks", "packages", "for-version"}
+	if !decl.isAppend {
+		allowed = append(allowed, "provides")
+	}
+	d.keys(root, "", allowed...)
+
+	base := filepath.Base(file)
+	decl.name = strings.TrimSuffix(strings.TrimSuffix(base, cartonSuffix), appendSuffix)
+	if name := d.str(root, "", "name"); name != nil {
+		decl.name = *name
+	}
+	if decl.name == "" {
+		return nil, fmt.Errorf("%s: %s", file, ErrNoName)
+	}
+
+	decl.desc = d.str(root, "", "description")
+	decl.homepage = d.str(root, "", "homepage")
+	decl.license = d.str(root, "", "license")
+	decl.licFiles = d.strs(root, "", "license-files")
+	for _, spec := range decl.licFiles {
+		if _, err := parseLicFile(spec); err != nil {
+			d.errorf("license-files", "%s", err)
+		}
+	}
+	decl.prefer = d.strOr(root, "", "prefer")
+	decl.provides = d.strs(root, "", "provides")
+	decl.variants = d.strs(root, "", "variants")
+	for _, v := range decl.variants {
+		if _, err := FindVariant(v); err != nil {
+			d.errorf("variants", "%s", err)
+		}
+	}
+
+	versions := d.table(root, "", "versions")
+	for _, ver := range d.keys(versions, "versions") {
+		decl.versions = append(decl.versions, declVersion{
+			version: ver,
+			srcurl:  d.strs(versions, "versions", ver),
+		})
+	}
+
+	d.body(decl, root, "")
+
+	forVersions := d.table(root, "", "for-version")
+	for _, pattern := range d.keys(forVersions, "for-version") {
+		prefix := join("for-version", pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			d.errorf(prefix, "%s", err)
+		}
+		t := d.table(forVersions, "for-version", pattern)
+		d.keys(t, prefix, "srcdir", "depends", "build-depends", "inherit", "vars",
+			"stages", "tasks")
+		fv := &declaration{file: file, vars: make(map[string]interface{})}
+		d.body(fv, t, prefix)
+		decl.forVersions = append(decl.forVersions, declForVersion{pattern, fv})
+	}
+
+	packages := d.table(root, "", "packages")
+	for _, name := range d.keys(packages, "packages") {
+		decl.packages = append(decl.packages, d.pkg(packages, name))
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return decl, nil
+}
+
+// body decodes keys which can be scoped by version from @table into @decl,
+// @prefix is path of @table
+func (d *decoder) body(decl *declaration, table map[string]interface{}, prefix string) {
+
+	decl.srcdir = d.strOr(table, prefix, "srcdir")
+	decl.depends = d.strs(table, prefix, "depends")
+	decl.buildDepends = d.strs(table, prefix, "build-depends")
+	decl.inherit = d.strs(table, prefix, "inherit")
+
+	vars := join(prefix, "vars")
+	for key, v := range d.table(table, prefix, "vars") {
+		switch v.(type) {
+		case string, bool:
+			decl.vars[key] = v
+		case int64:
+			decl.vars[key] = int(v.(int64))
+		default:
+			d.errorf(join(vars, key), "expected string, integer or boolean, got %T", v)
+		}
+	}
+
+	at := join(prefix, "stages")
+	stages := d.table(table, prefix, "stages")
+	for _, stage := range d.keys(stages, at, declStages...) {
+		decl.stages = append(decl.stages, declScript{
+			stage:  stage,
+			script: d.strOr(stages, at, stage),
+			pos:    d.doc.Positions[join(at, stage)],
+		})
+	}
+
+	at = join(prefix, "tasks")
+	tasks := d.table(table, prefix, "tasks")
+	for _, name := range d.keys(tasks, at) {
+		prefix := join(at, name)
+		t := d.table(tasks, at, name)
+		d.keys(t, prefix, "summary", "script")
+		decl.tasks = append(decl.tasks, declTask{
+			name:    name,
+			summary: d.strOr(t, prefix, "summary"),
+			script:  d.strOr(t, prefix, "script"),
+		})
+	}
+}
+
+// pkg decodes individual package @name
+func (d *decoder) pkg(packages map[string]interface{}, name string) *declPkg {
+
+	prefix := join("packages", name)
+	t := d.table(packages, "packages", name)
+	d.keys(t, prefix, "files", "depends", "recommends", "conflicts", "replaces",
+		"provides", "conffiles", "allow-empty", "scripts", "alternatives")
+
+	p := &declPkg{
+		name:       name,
+		files:      d.strs(t, prefix, "files"),
+		depends:    d.strs(t, prefix, "depends"),
+		recommends: d.strs(t, prefix, "recommends"),
+		conflicts:  d.strs(t, prefix, "conflicts"),
+		replaces:   d.strs(t, prefix, "replaces"),
+		provides:   d.strs(t, prefix, "provides"),
+		conffiles:  d.strs(t, prefix, "conffiles"),
+		scripts:    make(map[string]string),
+	}
+	for _, f := range p.conffiles {
+		if !filepath.IsAbs(f) {
+			d.errorf(join(prefix, "conffiles"), "conffile %s must be absolute path", f)
+		}
+	}
+
+	if v, ok := t["allow-empty"]; ok {
+		if p.allowEmpty, ok = v.(bool); !ok {
+			d.errorf(join(prefix, "allow-empty"), "expected boolean, got %T", v)
+		}
+	}
+
+	scripts := d.table(t, prefix, "scripts")
+	d.keys(scripts, join(prefix, "scripts"), pkg.PREINST, pkg.POSTINST, pkg.PRERM, pkg.POSTRM)
+	for kind := range scripts {
+		p.scripts[kind] = d.strOr(scripts, join(prefix, "scripts"), kind)
+	}
+
+	path := join(prefix, "alternatives")
+	alts, ok := t["alternatives"].([]interface{})
+	if _, exist := t["alternatives"]; exist && !ok {
+		d.errorf(path, "expected array of tables")
+	}
+	for _, v := range alts {
+		alt, ok := v.(map[string]interface{})
+		if !ok {
+			d.errorf(path, "expected array of tables, got %T", v)
+			continue
+		}
+		d.keys(alt, path, "name", "link", "target", "priority")
+		a := pkg.Alternative{
+			Name:   d.strOr(alt, path, "name"),
+			Link:   d.strOr(alt, path, "link"),
+			Target: d.strOr(alt, path, "target"),
+		}
+		if v, exist := alt["priority"]; exist {
+			priority, ok := v.(int64)
+			if !ok {
+				d.errorf(path, "priority of alternative %s: expected integer, got %T",
+					a.Name, v)
+			}
+			a.Priority = int(priority)
+		}
+		if a.Name == "" || !filepath.IsAbs(a.Link) || !filepath.IsAbs(a.Target) {
+			d.errorf(path, "alternative requires name, absolute link and target")
+		}
+		p.alternatives = append(p.alternatives, a)
+	}
+	return p
+}
@@ -0,0 +1,50 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDeclarationError(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "declarative")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		doc  string
+		want string // position and path of error
+	}{
+		{"[stages]\ninstall = \"true\"\ncompile = \"make\"\n", "foo.carton.toml:3: stages.compile"},
+		{"[for-version.\"1.*\".stages]\nbiuld = \"make\"\n",
+			"foo.carton.toml:2: for-version.1.*.stages.biuld"},
+		{"[packages.foo]\nconffiles = [\"/etc/foo.conf\", \"etc/bar.conf\"]\n",
+			"foo.carton.toml:2: packages.foo.conffiles"},
+		{"[packages.foo]\nalternatives = [\n{ name = \"sh\", link = \"/bin/sh\", " +
+			"target = \"/bin/bash\", priority = \"10\" },\n]\n",
+			"foo.carton.toml:2: packages.foo.alternatives"},
+		{"[packages.foo]\nalternatives = [\n{ name = \"sh\", link = \"/bin/sh\", " +
+			"target = \"/bin/bash\", priority = 10.0 },\n]\n",
+			"foo.carton.toml:2: packages.foo.alternatives"},
+	}
+
+	file := filepath.Join(dir, "foo.carton.toml")
+	for _, test := range tests {
+		if err := ioutil.WriteFile(file, []byte(test.doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := parseDeclaration(file)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("parseDeclaration(%q) = %v, want error at %s", test.doc, err, test.want)
+		}
+	}
+}
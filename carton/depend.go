@@ -0,0 +1,234 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"skygo/pkg"
+)
+
+// Dependency is one parsed dependency of carton
+//
+// format: [prefix]name[suffix][@stage][?] [(op version)]
+//
+//	prefix     prefix of variant, e.g. nativesdk- and lib32-, refer to Variant
+//	suffix     suffix of variant, e.g. -native and -cross
+//	           name without prefix or suffix depends on the variant which
+//	           dependencies of carton's variant resolve to
+//	@stage     waits until stage of carton is done, default is package
+//	?          optional dependency, it's skipped if carton is not found, and
+//	           it's only recommended by package of carton
+//	op         one of <<, <=, =, >=, >>. < and > are the same as << and >>
+//
+// e.g. "openssl (>= 1.1)", "linux@install", "m4-native", "doxygen-native?"
+type Dependency struct {
+	Name     string // carton name without prefix or suffix of variant
+	Variant  string // variant given explicitly, empty if none
+	Stage    string
+	Optional bool
+	Op       string
+	Version  string
+}
+
+// ParseDependency parses dependency specification @spec
+func ParseDependency(spec string) (*Dependency, error) {
+
+	d := new(Dependency)
+	s := strings.TrimSpace(spec)
+
+	if i := strings.Index(s, "("); i >= 0 {
+		if !strings.HasSuffix(s, ")") {
+			return nil, fmt.Errorf("dependency %s: version constraint is not closed", spec)
+		}
+		constraint := strings.TrimSpace(s[i+1 : len(s)-1])
+		s = strings.TrimSpace(s[:i])
+
+		op := strings.TrimRight(constraint, "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.:-+~_ ")
+		d.Version = strings.TrimSpace(constraint[len(op):])
+		switch op {
+		case "<<", "<=", "=", ">=", ">>":
+			d.Op = op
+		case "<":
+			d.Op = "<<"
+		case ">":
+			d.Op = ">>"
+		case "==":
+			d.Op = "="
+		default:
+			return nil, fmt.Errorf("dependency %s: unknown operator %q", spec, op)
+		}
+		if d.Version == "" {
+			return nil, fmt.Errorf("dependency %s: version is missing", spec)
+		}
+	}
+
+	if strings.HasSuffix(s, "?") {
+		d.Optional = true
+		s = strings.TrimSuffix(s, "?")
+	}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		d.Stage = s[i+1:]
+		s = s[:i]
+		if d.Stage == "" {
+			return nil, fmt.Errorf("dependency %s: stage is missing", spec)
+		}
+	}
+	if !exists(s) {
+		name, v, err := splitVariant(s)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: %s", spec, err)
+		}
+		if v != target {
+			d.Variant, s = v.name, name
+		}
+	}
+
+	if s == "" || strings.ContainsAny(s, " \t@?()") {
+		return nil, fmt.Errorf("dependency %s: invalid carton name", spec)
+	}
+	d.Name = s
+	return d, nil
+}
+
+// Carton returns name to find carton, including prefix or suffix of variant
+func (d *Dependency) Carton() string {
+	if v, err := FindVariant(d.Variant); err == nil {
+		return v.Of(d.Name)
+	}
+	return d.Name
+}
+
+// Host returns whether dependency is variant built for building machine,
+// e.g. native tools, which isn't required at runtime
+func (d *Dependency) Host() bool {
+	v, err := FindVariant(d.Variant)
+	return err == nil && v.Host
+}
+
+// Relation returns relationship of package required by carton of variant @v,
+// e.g. lib32-openssl (>= 1.1). dependency is resolved to main package of its
+// provider for the variant, e.g. virtual/kernel to linux. error of Find is
+// returned if provider is not found
+func (d *Dependency) Relation(v *Variant) (string, error) {
+
+	c, _, dv, err := v.Find(d.Carton())
+	if err != nil {
+		return "", err
+	}
+	name := dv.Of(c.Provider())
+	if d.Op != "" {
+		return fmt.Sprintf("%s (%s %s)", name, d.Op, d.Version), nil
+	}
+	return name, nil
+}
+
+// Satisfy returns whether version @ver satisfies version constraint
+func (d *Dependency) Satisfy(ver string) bool {
+	return d.Op == "" || pkg.SatisfyVersion(ver, d.Op, d.Version)
+}
+
+func (d *Dependency) String() string {
+
+	var b strings.Builder
+	b.WriteString(d.Carton())
+	if d.Stage != "" {
+		b.WriteString("@" + d.Stage)
+	}
+	if d.Optional {
+		b.WriteString("?")
+	}
+	if d.Op != "" {
+		fmt.Fprintf(&b, " (%s %s)", d.Op, d.Version)
+	}
+	return b.String()
+}
+
+// splitDepends splits dependency group @dep with delimiter space, version
+// constraint in parentheses belongs to the previous dependency
+func splitDepends(dep string) []string {
+
+	deps := []string{}
+	open := false
+	for _, field := range strings.Fields(dep) {
+		if open || (strings.HasPrefix(field, "(") && len(deps) > 0) {
+			deps[len(deps)-1] += " " + field
+		} else {
+			deps = append(deps, field)
+		}
+		if strings.Contains(field, "(") {
+			open = true
+		}
+		if strings.Contains(field, ")") {
+			open = false
+		}
+	}
+	return deps
+}
+
+// validateDepends checks dependencies of all cartons in inventory for each
+// variant they support: syntax, whether carton exists and supports variant
+// which dependency resolves to, whether stage exists and whether any version
+// of carton satisfies version constraint
+func validateDepends() error {
+
+	errs := []string{}
+	found := map[string]bool{} // the same error may be found by several variants
+	for name, c := range inventory {
+		for _, v := range variantsOf(c) {
+			for _, spec := range append(c.BuildDepends(), c.Depends()...) {
+				err := validateDepend(v, spec)
+				if err == nil {
+					continue
+				}
+				if e := fmt.Sprintf("carton %s: %s", name, err); !found[e] {
+					found[e] = true
+					errs = append(errs, e)
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("invalid dependency:\n\t%s", strings.Join(errs, "\n\t"))
+	}
+	return nil
+}
+
+// validateDepend checks dependency @spec of carton of variant @v
+func validateDepend(v *Variant, spec string) error {
+
+	d, err := ParseDependency(spec)
+	if err != nil {
+		return err
+	}
+
+	c, _, _, err := v.Find(d.Carton())
+	if err != nil {
+		if err == ErrNotFound && d.Optional {
+			return nil
+		}
+		return fmt.Errorf("dependency %s: %s", spec, err)
+	}
+
+	if d.Stage != "" && c.Runbook() != nil && c.Runbook().Stage(d.Stage) == nil {
+		return fmt.Errorf("dependency %s: %s has no stage %s", spec, c.Provider(), d.Stage)
+	}
+
+	if d.Op != "" {
+		versions := c.Resource().Versions()
+		for _, ver := range versions {
+			if d.Satisfy(ver) {
+				return nil
+			}
+		}
+		return fmt.Errorf("dependency %s: no version of %s satisfies, available: %s",
+			spec, c.Provider(), strings.Join(versions, ", "))
+	}
+	return nil
+}
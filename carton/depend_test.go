@@ -0,0 +1,104 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDependency(t *testing.T) {
+
+	tests := []struct {
+		spec   string
+		want   Dependency
+		carton string
+		host   bool
+	}{
+		{"openssl", Dependency{Name: "openssl"}, "openssl", false},
+		{" openssl ", Dependency{Name: "openssl"}, "openssl", false},
+		{"openssl (>= 1.1)", Dependency{Name: "openssl", Op: ">=", Version: "1.1"},
+			"openssl", false},
+		{"openssl(>=1.1)", Dependency{Name: "openssl", Op: ">=", Version: "1.1"},
+			"openssl", false},
+		{"a (<< 2)", Dependency{Name: "a", Op: "<<", Version: "2"}, "a", false},
+		{"a (< 2)", Dependency{Name: "a", Op: "<<", Version: "2"}, "a", false},
+		{"a (> 2)", Dependency{Name: "a", Op: ">>", Version: "2"}, "a", false},
+		{"a (== 2)", Dependency{Name: "a", Op: "=", Version: "2"}, "a", false},
+		{"a (= 1:2.0-r1)", Dependency{Name: "a", Op: "=", Version: "1:2.0-r1"}, "a", false},
+		{"linux@install", Dependency{Name: "linux", Stage: "install"}, "linux", false},
+		{"doxygen?", Dependency{Name: "doxygen", Optional: true}, "doxygen", false},
+		{"m4-native", Dependency{Name: "m4", Variant: NativeVariant}, "m4-native", true},
+		{"doxygen-native?", Dependency{Name: "doxygen", Variant: NativeVariant, Optional: true},
+			"doxygen-native", true},
+		{"m4-native@sysroot?", Dependency{Name: "m4", Variant: NativeVariant,
+			Stage: "sysroot", Optional: true}, "m4-native", true},
+		{"gcc-cross", Dependency{Name: "gcc", Variant: CrossVariant}, "gcc-cross", true},
+		{"lib32-zlib (>= 1.2)", Dependency{Name: "zlib", Variant: Lib32Variant,
+			Op: ">=", Version: "1.2"}, "lib32-zlib", false},
+		{"nativesdk-zlib", Dependency{Name: "zlib", Variant: NativeSDKVariant},
+			"nativesdk-zlib", false},
+		{"virtual/kernel", Dependency{Name: "virtual/kernel"}, "virtual/kernel", false},
+	}
+
+	for _, test := range tests {
+		d, err := ParseDependency(test.spec)
+		if err != nil {
+			t.Errorf("ParseDependency(%q): %s", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(*d, test.want) {
+			t.Errorf("ParseDependency(%q) = %+v, want %+v", test.spec, *d, test.want)
+		}
+		if c := d.Carton(); c != test.carton {
+			t.Errorf("ParseDependency(%q).Carton() = %s, want %s", test.spec, c, test.carton)
+		}
+		if h := d.Host(); h != test.host {
+			t.Errorf("ParseDependency(%q).Host() = %v, want %v", test.spec, h, test.host)
+		}
+	}
+
+	for _, spec := range []string{
+		"",
+		"a (>= 1.0",            // constraint is not closed
+		"a (~ 1)",              // unknown operator
+		"a (>=)",               // version is missing
+		"a@",                   // stage is missing
+		"a b",                  // invalid name
+		"@install",             // name is missing
+		"?",                    // name is missing
+		"nativesdk-foo-native", // ambiguous variant
+	} {
+		if d, err := ParseDependency(spec); err == nil {
+			t.Errorf("ParseDependency(%q) = %+v, want error", spec, *d)
+		}
+	}
+}
+
+func TestDependencySatisfy(t *testing.T) {
+
+	tests := []struct {
+		spec string
+		ver  string
+		want bool
+	}{
+		{"a", "1.0", true},
+		{"a (>= 1.1)", "1.1", true},
+		{"a (>= 1.1)", "1.0", false},
+		{"a (<< 2)", "1.9", true},
+		{"a (> 1.0)", "1.0", false},
+		{"a (= 1.0)", "1.0", true},
+	}
+
+	for _, test := range tests {
+		d, err := ParseDependency(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Satisfy(test.ver); got != test.want {
+			t.Errorf("%s satisfied by %s = %v, want %v", test.spec, test.ver, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// kind of dependency edge
+const (
+	BuildEdge   = "build"   // added by BuildDepends
+	RuntimeEdge = "runtime" // added by Depends
+	StageEdge   = "stage"   // added by Stage.AddDep
+	TaskEdge    = "task"    // added by TaskForce.AddDep
+)
+
+// Node is one carton in dependency graph
+// each variant of carton is a different node whose name has prefix or suffix
+// of variant, e.g. m4-native
+type Node struct {
+	Name    string `json:"name"`
+	Carton  string `json:"carton"`
+	Variant string `json:"variant"`
+	Native  bool   `json:"native"` // variant runs on building machine
+	Depth   int    `json:"depth"`  // distance from the nearest root
+}
+
+// Edge is one dependency between two nodes
+type Edge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Kind      string `json:"kind"`
+	FromStage string `json:"from_stage,omitempty"` // stage or task force of edge
+	ToStage   string `json:"to_stage,omitempty"`   // stage waited on
+	Virtual   string `json:"virtual,omitempty"`    // resolved virtual carton
+	Optional  bool   `json:"optional,omitempty"`
+	Version   string `json:"version,omitempty"` // version constraint
+}
+
+// Graph is dependency graph of cartons
+type Graph struct {
+	Roots []string `json:"roots"`
+	Nodes []*Node  `json:"nodes"`
+	Edges []*Edge  `json:"edges"`
+
+	nodes map[string]*Node
+}
+
+// Node returns node @name
+func (g *Graph) Node(name string) *Node {
+	return g.nodes[name]
+}
+
+// Out returns edges from node @name
+func (g *Graph) Out(name string) []*Edge {
+
+	edges := []*Edge{}
+	for _, e := range g.Edges {
+		if e.From == name {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// NewGraph builds dependency graph from cartons @roots, if no root is given,
+// all cartons in inventory are roots. dependencies deeper than @depth are not
+// visited unless @depth is 0. edges added by Stage.AddDep and TaskForce.AddDep
+// are included if @stages is true. dependencies of carton resolve to variant
+// by its variant, e.g. native carton's dependencies are native too
+func NewGraph(roots []string, depth int, stages bool) (*Graph, error) {
+
+	if len(roots) == 0 {
+		for name := range inventory {
+			roots = append(roots, name)
+		}
+		sort.Strings(roots)
+	}
+
+	g := &Graph{nodes: make(map[string]*Node)}
+
+	type visit struct {
+		name    string
+		variant *Variant
+		depth   int
+	}
+	queue := []visit{}
+
+	// addNode resolves @name required by variant @v to its provider, returns
+	// node name
+	addNode := func(name string, v *Variant, depth int) (string, string, error) {
+
+		c, isVirtual, variant, err := v.Find(name)
+		if err != nil {
+			return "", "", fmt.Errorf("carton %s: %s", name, err)
+		}
+
+		virtual := ""
+		if isVirtual {
+			virtual, _, _ = splitVariant(name)
+		}
+		n := variant.Of(c.Provider())
+		if _, ok := g.nodes[n]; !ok {
+			node := &Node{Name: n, Carton: c.Provider(), Variant: variant.name,
+				Native: variant.Host, Depth: depth}
+			g.nodes[n] = node
+			g.Nodes = append(g.Nodes, node)
+			queue = append(queue, visit{c.Provider(), variant, depth})
+		}
+		return n, virtual, nil
+	}
+
+	for _, root := range roots {
+		n, _, err := addNode(root, target, 0)
+		if err != nil {
+			return nil, err
+		}
+		g.Roots = append(g.Roots, n)
+	}
+
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		if depth > 0 && v.depth >= depth {
+			continue
+		}
+
+		c, _, _, _ := Find(v.name)
+		from := v.variant.Of(v.name)
+
+		for _, kind := range []string{BuildEdge, RuntimeEdge} {
+			specs := c.BuildDepends()
+			if kind == RuntimeEdge {
+				specs = c.Depends()
+			}
+			for _, spec := range specs {
+				d, err := ParseDependency(spec)
+				if err != nil {
+					return nil, fmt.Errorf("carton %s: %s", v.name, err)
+				}
+				if _, _, _, err := v.variant.Find(d.Carton()); err == ErrNotFound && d.Optional {
+					continue
+				}
+				to, virtual, err := addNode(d.Carton(), v.variant, v.depth+1)
+				if err != nil {
+					return nil, err
+				}
+				e := &Edge{From: from, To: to, Kind: kind, ToStage: d.Stage,
+					Virtual: virtual, Optional: d.Optional}
+				if d.Op != "" {
+					e.Version = d.Op + " " + d.Version
+				}
+				g.Edges = append(g.Edges, e)
+			}
+		}
+
+		rb := c.Runbook()
+		if !stages || rb == nil {
+			continue
+		}
+		add := func(kind, owner string, deps []string) error {
+			for _, dep := range deps {
+				runbook, stage := dep, ""
+				if i := strings.LastIndex(dep, "@"); i >= 0 {
+					runbook, stage = dep[:i], dep[i+1:]
+				}
+				to, virtual, err := addNode(runbook, v.variant, v.depth+1)
+				if err != nil {
+					return err
+				}
+				g.Edges = append(g.Edges, &Edge{From: from, To: to, Kind: kind,
+					FromStage: owner, ToStage: stage, Virtual: virtual})
+			}
+			return nil
+		}
+		for s := rb.Head(); s != nil; s = s.Next() {
+			if err := add(StageEdge, s.Name(), s.Depends()); err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range rb.TaskForces() {
+			if err := add(TaskEdge, name, rb.TaskForce(name).Depends()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return g, nil
+}
@@ -26,11 +26,26 @@ type Modifier interface {
 	SetSrcDir(dir string) error
 
 	// used to update dependency
-	// dep format: cartonName or carton group
+	// dep format: dependency or dependency group, refer to Dependency
 	Depends(dep ...string) []string
 	BuildDepends(dep ...string) []string
 
+	// Variants adds variants which carton supports, refer to Variant
+	Variants(name ...string) []string
+
+	// LicFiles adds license files whose checksums are verified after
+	// fetching, refer to Carton.LicFiles
+	LicFiles(spec ...string) []string
+
 	runbook.KVSetter
+	runbook.KVOverrider
+
+	// Inherit applies classes to add standard tasks, refer to NewClass
+	Inherit(class ...string)
+
+	// ForVersion modifies carton only when selected version matches pattern,
+	// refer to Carton.ForVersion
+	ForVersion(pattern string, m func(Modifier))
 
 	// Runbook give runbook
 	Runbook() *runbook.Runbook
@@ -54,17 +69,20 @@ type Builder interface {
 	From(file ...string) []string
 
 	// BuildDepends add depends only required for building from scratch
-	// dep format: cartonName or carton group
-	// carton group is a collection of cartonName with delimiter space
+	// dep format: dependency or dependency group, refer to Dependency
+	// dependency group is a collection of dependency with delimiter space
 	// Always return the same kind of depends
 	BuildDepends(...string) []string
 
 	// Depends add depends required for building from scratch, running or both
-	// dep format: cartonName or carton group
-	// carton group is a collection of cartonName with delimiter space
+	// dep format: dependency or dependency group, refer to Dependency
+	// dependency group is a collection of dependency with delimiter space
 	// Always return the same kind of depends
 	Depends(...string) []string
 
+	// Variants returns variants which carton supports besides target
+	Variants(...string) []string
+
 	// Runbook return runbook
 	Runbook() *runbook.Runbook
 
@@ -73,11 +91,17 @@ type Builder interface {
 
 	runbook.KVGetter
 
+	// Overrides returns conditional assignments of key-value
+	Overrides() []runbook.Override
+
 	// return where source code is under WORKDIR
 	SrcDir(wd string) string
 
 	// FilesPath return a collection of directory that's be used for locating local file
 	FilesPath() []string
 
+	// Packager return package handler
+	Packager() pkg.Packager
+
 	String() string
 }
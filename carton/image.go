@@ -5,33 +5,212 @@
 package carton
 
 import (
-	"skygo/runbook"
+	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
+
+	"skygo/pkg"
+	"skygo/runbook"
+	"skygo/utils"
+	"skygo/utils/log"
 )
 
 // Image inherits Carton
+// Type is image types with delimiter space, e.g. "tar.gz ext4", refer to
+// NewImageType. if it's empty, IMAGE_FSTYPES is used, then tar.gz
 type Image struct {
 	Type string
 	Carton
+
+	packages []string // packages installed into rootfs
 }
 
 func (e *Image) String() string { return e.Carton.String() }
 
 // NewImage create a image carton and add to inventory
+// root filesystem is WORKDIR/rootfs unless IMAGE_ROOTFS is set. if packages
+// are given by Install, stage prepare assembles it from packages. stage build
+// makes images of each type under WORKDIR/images, stage install copies them,
+// manifest, SPDX document and directory of license texts to IMAGEDIR with
+// name <name>[-MACHINE].<type>
 func NewImage(name string, m func(i *Image)) {
 
 	i := new(Image)
 	i.name = name
-	_, file, _, _ := runtime.Caller(1)
+	_, file, line, _ := runtime.Caller(1)
+	i.line = line
 
 	// inherits i.Carton.Init
 	i.Init(file, i, func(arg Modifier) {
 
 		rb := runbook.NewRunbook()
 		rb.PushFront(PREPARE).Summary("Prepares something for build").
+			AddTask(0, func(ctx runbook.Context) error {
+				return i.rootfs(ctx)
+			}).
 			InsertAfter(BUILD).Summary("Make image").
-			InsertAfter(INSTALL).Summary("Copy images to deploy directory")
+			AddTask(0, func(ctx runbook.Context) error {
+				return i.build(ctx)
+			}).
+			InsertAfter(INSTALL).Summary("Copy images to deploy directory").
+			AddTask(0, func(ctx runbook.Context) error {
+				return i.install(ctx)
+			})
 		i.SetRunbook(rb)
 		m(i)
 	})
 }
+
+// Install adds packages installed into root filesystem with their runtime
+// dependencies, refer to pkg.Closure. cartons which ship packages become
+// build dependencies of image when inventory is built
+// Always return all packages
+func (i *Image) Install(pkgs ...string) []string {
+	i.packages = append(i.packages, pkgs...)
+	return i.packages
+}
+
+// resolve adds cartons which ship installed packages to build dependencies,
+// so package data is ready before stage prepare assembles root filesystem
+func (i *Image) resolve() error {
+
+	deps := map[string]bool{}
+	for _, spec := range i.BuildDepends() {
+		if d, err := ParseDependency(spec); err == nil {
+			deps[d.Carton()] = true
+		}
+	}
+
+	for _, name := range i.packages {
+		provider, err := pkgProvider(name)
+		if err != nil {
+			return fmt.Errorf("image %s: %s", i.name, err)
+		}
+		if provider != i.name && !deps[provider] {
+			deps[provider] = true
+			i.BuildDepends(provider)
+		}
+	}
+	return nil
+}
+
+// rootfs assembles root filesystem from packages recorded in PKGDATADIR
+// it refuses packages whose licenses match INCOMPATIBLE_LICENSES. manifest,
+// SPDX document and license texts of installed packages are written under
+// WORKDIR/images
+func (i *Image) rootfs(ctx runbook.Context) error {
+
+	if len(i.packages) == 0 {
+		return nil
+	}
+
+	records, err := pkg.ReadRecords(pkg.PkgdataDir(ctx.GetStr("PKGDATADIR"),
+		ctx.GetStr("TARGETSYS")))
+	if err != nil {
+		return err
+	}
+	closure, err := pkg.Closure(records, i.packages)
+	if err != nil {
+		return fmt.Errorf("image %s: %s", i.name, err)
+	}
+	if err := pkg.CheckLicenses(closure, fields(ctx, "INCOMPATIBLE_LICENSES")); err != nil {
+		return fmt.Errorf("image %s: %s", i.name, err)
+	}
+
+	rootfs := rootfsDir(ctx)
+	log.Info("Install %d packages into %s", len(closure), rootfs)
+	if err := pkg.InstallRootfs(rootfs, closure); err != nil {
+		return fmt.Errorf("image %s: %s", i.name, err)
+	}
+
+	dir := filepath.Join(ctx.GetStr("WORKDIR"), "images")
+	os.MkdirAll(dir, 0755)
+	if err := pkg.WriteManifest(filepath.Join(dir, i.name+".manifest"), closure); err != nil {
+		return err
+	}
+	if err := pkg.CollectLicenses(filepath.Join(dir, i.name+".licenses"), closure); err != nil {
+		return err
+	}
+	return pkg.WriteSPDX(filepath.Join(dir, i.name+".spdx.json"), i.name, closure)
+}
+
+// types returns image types
+func (i *Image) types(ctx runbook.Context) []string {
+
+	types := strings.Fields(i.Type)
+	if len(types) == 0 {
+		types = strings.Fields(ctx.GetStr("IMAGE_FSTYPES"))
+	}
+	if len(types) == 0 {
+		types = []string{"tar.gz"}
+	}
+	return types
+}
+
+func rootfsDir(ctx runbook.Context) string {
+
+	if dir := ctx.GetStr("IMAGE_ROOTFS"); dir != "" {
+		return dir
+	}
+	return filepath.Join(ctx.GetStr("WORKDIR"), "rootfs")
+}
+
+func (i *Image) build(ctx runbook.Context) error {
+
+	rootfs := rootfsDir(ctx)
+	if !utils.IsExist(rootfs) {
+		return fmt.Errorf("root filesystem %s of image %s is not found", rootfs, i.name)
+	}
+
+	dir := filepath.Join(ctx.GetStr("WORKDIR"), "images")
+	os.MkdirAll(dir, 0755)
+
+	for _, t := range i.types(ctx) {
+		f, err := imageType(t)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(dir, i.name+"."+t)
+		log.Trace("Make image %s", out)
+		if err := f(ctx, rootfs, out); err != nil {
+			return fmt.Errorf("image %s: %s", out, err)
+		}
+	}
+	return nil
+}
+
+func (i *Image) install(ctx runbook.Context) error {
+
+	dir := filepath.Join(ctx.GetStr("WORKDIR"), "images")
+	deploy := ctx.GetStr("IMAGEDIR")
+
+	name := i.name
+	if machine := ctx.GetStr("MACHINE"); machine != "" {
+		name += "-" + machine
+	}
+
+	suffixes := i.types(ctx)
+	if len(i.packages) > 0 {
+		suffixes = append(suffixes, "manifest", "spdx.json")
+
+		licenses := filepath.Join(deploy, name+".licenses")
+		os.RemoveAll(licenses)
+		if err := utils.CopyTree(filepath.Join(dir, i.name+".licenses"), licenses); err != nil {
+			return err
+		}
+	}
+	for _, t := range suffixes {
+		f, err := os.Open(filepath.Join(dir, i.name+"."+t))
+		if err != nil {
+			return err
+		}
+		err = utils.CopyFile(filepath.Join(deploy, name+"."+t), 0644, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"skygo/runbook"
+)
+
+// ImageTypeFunc makes image file @out from root filesystem @rootfs
+type ImageTypeFunc func(ctx runbook.Context, rootfs, out string) error
+
+// imageTypes holds all registered image types
+var (
+	imageTypes  = make(map[string]ImageTypeFunc)
+	imageTypesM sync.Mutex
+)
+
+// NewImageType registers image type @name, it's also suffix of image file
+// builtin image types are tar, tar.gz, ext4, squashfs, cpio and cpio.gz
+func NewImageType(name string, f ImageTypeFunc) {
+
+	imageTypesM.Lock()
+	defer imageTypesM.Unlock()
+	if _, ok := imageTypes[name]; ok {
+		panic(fmt.Sprintf("Carton Err: image type %s had been added!", name))
+	}
+	imageTypes[name] = f
+}
+
+// ImageTypes returns names of all image types, sorted by name
+func ImageTypes() []string {
+
+	imageTypesM.Lock()
+	defer imageTypesM.Unlock()
+
+	names := make([]string, 0, len(imageTypes))
+	for name := range imageTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func imageType(name string) (ImageTypeFunc, error) {
+
+	imageTypesM.Lock()
+	f, ok := imageTypes[name]
+	imageTypesM.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown image type %s, candidates: %s", name,
+			strings.Join(ImageTypes(), ", "))
+	}
+	return f, nil
+}
+
+func init() {
+
+	NewImageType("tar", func(ctx runbook.Context, rootfs, out string) error {
+		return writeImage(out, func(w io.Writer) error { return writeTar(w, rootfs) })
+	})
+	NewImageType("tar.gz", func(ctx runbook.Context, rootfs, out string) error {
+		return writeImage(out, func(w io.Writer) error {
+			return gzipped(w, func(w io.Writer) error { return writeTar(w, rootfs) })
+		})
+	})
+	NewImageType("cpio", func(ctx runbook.Context, rootfs, out string) error {
+		return writeImage(out, func(w io.Writer) error { return writeCpio(w, rootfs) })
+	})
+	NewImageType("cpio.gz", func(ctx runbook.Context, rootfs, out string) error {
+		return writeImage(out, func(w io.Writer) error {
+			return gzipped(w, func(w io.Writer) error { return writeCpio(w, rootfs) })
+		})
+	})
+
+	NewImageType("ext4", func(ctx runbook.Context, rootfs, out string) error {
+
+		size, err := imageSize(ctx, rootfs)
+		if err != nil {
+			return err
+		}
+		os.Remove(out)
+		args := []string{"-t", "ext4", "-F", "-q", "-d", rootfs,
+			"-E", "root_owner=0:0"}
+		if label := ctx.GetStr("IMAGE_LABEL"); label != "" {
+			args = append(args, "-L", label)
+		}
+		args = append(args, out, fmt.Sprintf("%dk", size))
+		return runImageTool(ctx, "mke2fs", args...)
+	})
+
+	NewImageType("squashfs", func(ctx runbook.Context, rootfs, out string) error {
+
+		os.Remove(out)
+		args := []string{rootfs, out, "-noappend", "-all-root"}
+		if comp := ctx.GetStr("SQUASHFS_COMP"); comp != "" {
+			args = append(args, "-comp", comp)
+		}
+		return runImageTool(ctx, "mksquashfs", args...)
+	})
+}
+
+func runImageTool(ctx runbook.Context, name string, args ...string) error {
+
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("%s is required to make image: %s", name, err)
+	}
+	cmd := runbook.NewCommand(ctx, name, args...)
+	return cmd.Run(ctx, BUILD)
+}
+
+// intVar retrieves integer @key which is int or string, @def is returned
+// if it's not set
+func intVar(ctx runbook.Context, key string, def int) (int, error) {
+
+	switch v := ctx.Get(key).(type) {
+	case nil:
+		return def, nil
+	case int:
+		return v, nil
+	case string:
+		if v == "" {
+			return def, nil
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s", key, err)
+		}
+		return i, nil
+	default:
+		return 0, fmt.Errorf("%s: expected integer, got %T", key, v)
+	}
+}
+
+// imageSize calculates size of image in KiB for file system image
+//
+//	IMAGE_OVERHEAD: percentage of rootfs size added for metadata, default 30
+//	IMAGE_EXTRA_SPACE: KiB added after overhead, default 0
+//	IMAGE_ROOTFS_SIZE: minimum size in KiB, default 0
+func imageSize(ctx runbook.Context, rootfs string) (int, error) {
+
+	var used int64
+	err := filepath.Walk(rootfs, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// round up to 4KiB block
+		used += (info.Size() + 4095) / 4096 * 4
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	overhead, err := intVar(ctx, "IMAGE_OVERHEAD", 30)
+	if err != nil {
+		return 0, err
+	}
+	extra, err := intVar(ctx, "IMAGE_EXTRA_SPACE", 0)
+	if err != nil {
+		return 0, err
+	}
+	min, err := intVar(ctx, "IMAGE_ROOTFS_SIZE", 0)
+	if err != nil {
+		return 0, err
+	}
+
+	size := int(used)*(100+overhead)/100 + extra
+	if size < min {
+		size = min
+	}
+	return size, nil
+}
+
+// writeImage writes image file @out by @f, file is removed if it fails
+func writeImage(out string, f func(io.Writer) error) error {
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err = f(w); err == nil {
+		err = w.Flush()
+	}
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(out)
+	}
+	return err
+}
+
+func gzipped(w io.Writer, f func(io.Writer) error) error {
+
+	zw := gzip.NewWriter(w)
+	if err := f(zw); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// walkRootfs visits files under @rootfs in lexical order, @rel is path
+// relative to @rootfs, root itself is "."
+func walkRootfs(rootfs string, f func(path, rel string, info os.FileInfo) error) error {
+
+	return filepath.Walk(rootfs, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(rootfs, path)
+		return f(path, rel, info)
+	})
+}
+
+// writeTar archives @rootfs, all files are owned by root
+func writeTar(w io.Writer, rootfs string) error {
+
+	tw := tar.NewWriter(w)
+	err := walkRootfs(rootfs, func(path, rel string, info os.FileInfo) error {
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			var err error
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = "./" + filepath.ToSlash(rel)
+		switch {
+		case rel == ".":
+			hdr.Name = "./"
+		case info.IsDir():
+			hdr.Name += "/"
+		}
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "root", "root"
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFrom(tw, path)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func copyFrom(w io.Writer, path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// writeCpio archives @rootfs in newc format used by initramfs, all files are
+// owned by root
+func writeCpio(w io.Writer, rootfs string) error {
+
+	var (
+		ino     = 0
+		written int64
+	)
+
+	write := func(b []byte) error {
+		n, err := w.Write(b)
+		written += int64(n)
+		return err
+	}
+	pad := func() error {
+		if n := written % 4; n != 0 {
+			return write(make([]byte, 4-n))
+		}
+		return nil
+	}
+	header := func(name string, mode uint32, nlink int, size int64, rdev uint64) error {
+		ino++
+		hdr := fmt.Sprintf("070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+			ino, mode, 0, 0, nlink, 0, size, 0, 0,
+			(rdev>>8)&0xfff|(rdev>>32)&^0xfff, rdev&0xff|(rdev>>12)&^0xff, len(name)+1, 0)
+		if err := write([]byte(hdr + name + "\x00")); err != nil {
+			return err
+		}
+		return pad()
+	}
+
+	err := walkRootfs(rootfs, func(path, rel string, info os.FileInfo) error {
+
+		mode := uint32(info.Mode().Perm())
+		if info.Mode()&os.ModeSetuid != 0 {
+			mode |= syscall.S_ISUID
+		}
+		if info.Mode()&os.ModeSetgid != 0 {
+			mode |= syscall.S_ISGID
+		}
+		if info.Mode()&os.ModeSticky != 0 {
+			mode |= syscall.S_ISVTX
+		}
+
+		var rdev uint64
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			rdev = uint64(st.Rdev)
+		}
+
+		switch m := info.Mode(); {
+		case m.IsDir():
+			return header(rel, mode|syscall.S_IFDIR, 2, 0, 0)
+
+		case m&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := header(rel, mode|syscall.S_IFLNK, 1, int64(len(link)), 0); err != nil {
+				return err
+			}
+			if err := write([]byte(link)); err != nil {
+				return err
+			}
+			return pad()
+
+		case m.IsRegular():
+			if err := header(rel, mode|syscall.S_IFREG, 1, info.Size(), 0); err != nil {
+				return err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(w, f)
+			f.Close()
+			written += n
+			if err != nil {
+				return err
+			}
+			return pad()
+
+		case m&os.ModeCharDevice != 0:
+			return header(rel, mode|syscall.S_IFCHR, 1, 0, rdev)
+		case m&os.ModeDevice != 0:
+			return header(rel, mode|syscall.S_IFBLK, 1, 0, rdev)
+		case m&os.ModeNamedPipe != 0:
+			return header(rel, mode|syscall.S_IFIFO, 1, 0, 0)
+		case m&os.ModeSocket != 0:
+			return header(rel, mode|syscall.S_IFSOCK, 1, 0, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := header("TRAILER!!!", 0, 1, 0, 0); err != nil {
+		return err
+	}
+	// pad archive to 512 bytes like cpio does
+	if n := written % 512; n != 0 {
+		return write(make([]byte, 512-n))
+	}
+	return nil
+}
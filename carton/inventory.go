@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 
@@ -16,12 +17,28 @@ import (
 
 // hold all carton and its variants
 var inventory = make(map[string]Builder)
-var virtualInventory = make(map[string]Builder)
 
-var initCh = make(chan func())   // associated with NewCarton
-var updateCh = make(chan func()) // associated with Update
+// virtual carton may have several providers, one of them is selected by
+// preferred provider
+var (
+	virtualInventory = make(map[string][]Builder)
+	preferred        = make(map[string]string) // virtual -> provider
+	virtualMu        sync.Mutex
+)
+
+var initCh = make(chan func()) // associated with NewCarton
+
+// update is queued by Update, and applied by BuildInventory
+type update struct {
+	name string
+	file string
+	m    func(Modifier)
+}
 
-var updateNum int
+var (
+	updates  []update
+	updatesM sync.Mutex
+)
 
 /*
 Carton's dependcy hierarchy is a directed graph. Each carton is vertex,
@@ -77,60 +94,172 @@ func add(carton Builder, file string, f func()) {
 func addVirtual(carton Builder, target, file string) {
 
 	carton.From(file)
-	virtualInventory[target] = carton
+
+	virtualMu.Lock()
+	defer virtualMu.Unlock()
+
+	providers := virtualInventory[target]
+	for i, c := range providers {
+		if c.Provider() == carton.Provider() {
+			providers[i] = carton
+			return
+		}
+	}
+	virtualInventory[target] = append(providers, carton)
+}
+
+// AmbiguousError reports virtual carton has more than one provider, but no
+// one is preferred
+type AmbiguousError struct {
+	Name       string
+	Candidates []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("%s is provided by %s, select one by preferred provider",
+		e.Name, strings.Join(e.Candidates, ", "))
+}
+
+// PreferredProvider selects carton @provider to provide virtual carton
+// @virtual if several cartons provide it. carton can be preferred to provide
+// itself even if other cartons provide the same name
+func PreferredProvider(virtual, provider string) {
+
+	virtualMu.Lock()
+	preferred[virtual] = provider
+	virtualMu.Unlock()
+}
+
+// Providers returns names of all cartons providing @name, sorted by name
+// carton @name itself is included if it exists
+func Providers(name string) []string {
+
+	virtualMu.Lock()
+	defer virtualMu.Unlock()
+	return providers(name)
+}
+
+func providers(name string) []string {
+
+	names := []string{}
+	if _, ok := inventory[name]; ok {
+		names = append(names, name)
+	}
+	for _, c := range virtualInventory[name] {
+		names = append(names, c.Provider())
+	}
+	sort.Strings(names)
+	return names
 }
 
 // Update find the carton and then update it in callback
 // modifier function m is called after carton @name is added by NewCarton
+// updates of one carton are applied in order of layer priority from low to
+// high, then file path, then call order. refer to Layer
 func Update(name string, m func(Modifier)) {
 
-	carton, ok := inventory[name]
-	if !ok {
+	_, file, _, _ := runtime.Caller(1)
+	updateFrom(name, file, m)
+}
+
+// updateFrom updates carton @name in callback @m, @file describes the update
+func updateFrom(name, file string, m func(Modifier)) {
+
+	if _, ok := inventory[name]; !ok {
 		log.Warning("carton %s is not found for updating", name)
 		return
 	}
 	if m != nil {
+		updatesM.Lock()
+		updates = append(updates, update{name: name, file: file, m: m})
+		updatesM.Unlock()
+	}
+}
 
-		_, file, _, _ := runtime.Caller(1)
-		updateNum++
+// Find find the carton by name
+// if name has prefix or suffix of variant, e.g. "-native", trim it before
+// finding in database, and return the variant. error is returned if carton
+// doesn't support it, refer to Variant
+// preferred provider of name wins, then carton whose name is the same, then
+// the only provider of virtual carton. if virtual carton has several providers
+// but no one is preferred, return AmbiguousError
+// if not found, return ErrNotFound
+func Find(name string) (h Builder, isVirtual bool, variant *Variant, err error) {
 
-		// run in goroutine to improve user experience
-		go func() {
-			updateCh <- func() {
-				carton.From(file)
-				m(carton.(Modifier))
-			}
-		}()
+	variant = target
+	if !exists(name) {
+		if name, variant, err = splitVariant(name); err != nil {
+			return
+		}
 	}
 
+	h, isVirtual, err = find(name)
+	if err == nil {
+		if err = supports(h, variant); err != nil {
+			return nil, isVirtual, variant, err
+		}
+	}
+	return h, isVirtual, variant, err
 }
 
-// Find find the carton by name
-// if name have suffix "-native", isNative is true and trim it before
-// finding in database
-// if not found, return ErrNotFound
-func Find(name string) (h Builder, isVirtual bool, isNative bool, err error) {
+// exists returns whether carton or virtual carton @name exists
+func exists(name string) bool {
+
+	virtualMu.Lock()
+	defer virtualMu.Unlock()
+
+	_, isReal := inventory[name]
+	return isReal || len(virtualInventory[name]) > 0
+}
+
+func find(name string) (Builder, bool, error) {
 
-	if strings.HasSuffix(name, "-native") {
-		isNative = true
-		name = strings.TrimSuffix(name, "-native")
+	virtualMu.Lock()
+	defer virtualMu.Unlock()
+
+	carton, isReal := inventory[name]
+	candidates := virtualInventory[name]
+
+	if provider, ok := preferred[name]; ok {
+		if provider == name && isReal {
+			return carton, false, nil
+		}
+		for _, c := range candidates {
+			if c.Provider() == provider {
+				return c, true, nil
+			}
+		}
+		return nil, true, fmt.Errorf(
+			"preferred provider %s of %s is not found, candidates: %s", provider, name,
+			strings.Join(providers(name), ", "))
 	}
 
-	// TODO: handle if exist in both inventory
-	if carton, ok := inventory[name]; ok {
-		return carton, false, isNative, nil
+	if isReal {
+		return carton, false, nil
 	}
 
-	if virtual, ok := virtualInventory[name]; ok {
-		return virtual, true, isNative, nil
+	switch len(candidates) {
+	case 0:
+		return nil, true, ErrNotFound
+	case 1:
+		return candidates[0], true, nil
 	}
-	return nil, true, isNative, ErrNotFound
+	return nil, true, &AmbiguousError{Name: name, Candidates: providers(name)}
 }
 
-// BuildInventory build carton warehouse and then check whether each carton has
-// loop dependcy hierarchy.
+// BuildInventory build carton warehouse, validates dependencies and then check
+// whether each carton has loop dependcy hierarchy.
 func BuildInventory(ctx context.Context) error {
+	if err := validateLayers(); err != nil {
+		return err
+	}
 	buildInventory()
+	if err := resolveImages(); err != nil {
+		return err
+	}
+	if err := validateDepends(); err != nil {
+		return err
+	}
 	return detectLoopDep(ctx)
 }
 
@@ -152,17 +281,96 @@ func buildInventory() {
 	wg.Wait()
 	close(initCh)
 
-	wg.Add(updateNum)
+	updatesM.Lock()
+	sort.SliceStable(updates, func(i, j int) bool {
+		pi, pj := priorityOf(updates[i].file), priorityOf(updates[j].file)
+		if pi != pj {
+			return pi < pj
+		}
+		return updates[i].file < updates[j].file
+	})
+
+	// updates of the same carton are applied one by one
+	names := []string{}
+	groups := make(map[string][]update)
+	for _, u := range updates {
+		if _, ok := groups[u.name]; !ok {
+			names = append(names, u.name)
+		}
+		groups[u.name] = append(groups[u.name], u)
+	}
+	updatesM.Unlock()
+
+	updateCh := make(chan []update)
+	wg.Add(len(names))
 	for i := 0; i < num; i++ {
 		go func() {
-			for cb := range updateCh {
-				cb()
+			for group := range updateCh {
+				for _, u := range group {
+					carton := inventory[u.name]
+					carton.From(u.file)
+					u.m(carton.(Modifier))
+				}
 				wg.Done()
 			}
 		}()
 	}
+	for _, name := range names {
+		updateCh <- groups[name]
+	}
 	wg.Wait()
 	close(updateCh)
+
+	// version is settled after all updates
+	for _, carton := range inventory {
+		if m, ok := carton.(Modifier); ok {
+			toCarton(m).applyForVersions(m)
+		}
+	}
+}
+
+// resolveImages adds cartons which ship packages installed by images to
+// their build dependencies
+func resolveImages() error {
+
+	for _, c := range inventory {
+		if i, ok := c.(*Image); ok {
+			if err := i.resolve(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pkgProvider returns carton which ships package @name. package of variant
+// resolves to carton of the variant, e.g. lib32-zlib-dev to lib32-zlib
+func pkgProvider(name string) (string, error) {
+
+	base, v, err := splitVariant(name)
+	if err != nil {
+		return "", err
+	}
+
+	virtualMu.Lock()
+	defer virtualMu.Unlock()
+
+	names := make([]string, 0, len(inventory))
+	for n := range inventory {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		c := inventory[n]
+		if c.Packager().GetPkg(name) != nil {
+			return n, nil
+		}
+		if v != target && c.Packager().GetPkg(base) != nil && supports(c, v) == nil {
+			return v.Of(n), nil
+		}
+	}
+	return "", fmt.Errorf("no carton ships package %s", name)
 }
 
 // detectLoopDep find whether inventory has any carton whose dependcy hierarchy
@@ -181,8 +389,10 @@ func detectLoopDep(ctx context.Context) error {
 
 		ch := make(chan string)
 		go func() {
-			for carton := range inventory {
-				ch <- carton
+			for name, carton := range inventory {
+				for _, v := range variantsOf(carton) {
+					ch <- v.Of(name)
+				}
 			}
 			close(ch)
 		}()
@@ -282,17 +492,25 @@ func (d *dfs) cyclicUtil(ctx context.Context, vertex string) error {
 
 func adjacentEdges(name string) ([]string, error) {
 
-	b, _, _, e := Find(name)
+	b, _, v, e := Find(name)
 	if e != nil {
 		return nil, fmt.Errorf("carton %s: %s", name, e)
 	}
 
-	dep := b.BuildDepends()
-	required := b.Depends()
-
 	edges := []string{}
-	edges = append(edges, dep...)
-	edges = append(edges, required...)
-
+	for _, spec := range append(b.BuildDepends(), b.Depends()...) {
+		d, err := ParseDependency(spec)
+		if err != nil {
+			return nil, fmt.Errorf("carton %s: %s", name, err)
+		}
+		c, _, dv, err := v.Find(d.Carton())
+		if err == ErrNotFound && d.Optional {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("carton %s: %s", name, err)
+		}
+		edges = append(edges, dv.Of(c.Provider()))
+	}
 	return edges, nil
 }
@@ -0,0 +1,253 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"skygo/utils/toml"
+)
+
+// LayerSeries is series of carton interface, layer declares which series it
+// is compatible with. it's bumped when carton interface changes incompatibly
+const LayerSeries = "1"
+
+// layerFile describes layer of declarative cartons in layer directory
+const layerFile = "layer.toml"
+
+// Layer is a collection of cartons and updates, which are described by files
+// under its directory. updates of carton are applied in order of priority of
+// their layers, so layer of higher priority wins
+type Layer struct {
+	Desc     string   // oneline description
+	Priority int      // default is 0
+	Compat   []string // compatible series, refer to LayerSeries. empty is any
+	Depends  []string // layers required by this layer
+
+	name string
+	dir  string
+}
+
+var (
+	layers  = make(map[string]*Layer)
+	layersM sync.Mutex
+)
+
+// NewLayer registers layer @name whose directory is where caller is. Go
+// package of cartons calls it to declare itself as a layer
+func NewLayer(name string, m func(l *Layer)) {
+
+	_, file, _, _ := runtime.Caller(1)
+	if err := newLayer(name, filepath.Dir(file), m); err != nil {
+		panic(fmt.Sprintf("Carton Err: %s", err))
+	}
+}
+
+func newLayer(name, dir string, m func(l *Layer)) error {
+
+	layersM.Lock()
+	defer layersM.Unlock()
+
+	if l, ok := layers[name]; ok {
+		return fmt.Errorf("layer %s had been added from %s", name, l.dir)
+	}
+	l := &Layer{name: name, dir: filepath.Clean(dir)}
+	if m != nil {
+		m(l)
+	}
+	layers[name] = l
+	return nil
+}
+
+// Name returns name of layer
+func (l *Layer) Name() string { return l.name }
+
+// Dir returns directory of layer
+func (l *Layer) Dir() string { return l.dir }
+
+// Layers returns all layers, sorted by priority from high to low, then name
+func Layers() []*Layer {
+
+	layersM.Lock()
+	defer layersM.Unlock()
+
+	all := make([]*Layer, 0, len(layers))
+	for _, l := range layers {
+		all = append(all, l)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Priority != all[j].Priority {
+			return all[i].Priority > all[j].Priority
+		}
+		return all[i].name < all[j].name
+	})
+	return all
+}
+
+// FindLayer finds layer @name
+func FindLayer(name string) (*Layer, error) {
+
+	layersM.Lock()
+	defer layersM.Unlock()
+
+	if l, ok := layers[name]; ok {
+		return l, nil
+	}
+	return nil, fmt.Errorf("layer %s is not found", name)
+}
+
+// layerOf returns layer whose directory is the nearest parent of @file, nil
+// if file doesn't belong to any layer
+func layerOf(file string) *Layer {
+
+	layersM.Lock()
+	defer layersM.Unlock()
+
+	var found *Layer
+	for _, l := range layers {
+		if strings.HasPrefix(file, l.dir+string(filepath.Separator)) &&
+			(found == nil || len(l.dir) > len(found.dir)) {
+			found = l
+		}
+	}
+	return found
+}
+
+// priorityOf returns priority of layer which @file belongs to, 0 if none
+func priorityOf(file string) int {
+
+	if l := layerOf(file); l != nil {
+		return l.Priority
+	}
+	return 0
+}
+
+// Cartons returns cartons defined by files of layer and cartons modified by
+// them, both sorted by name. It's valid after BuildInventory
+func (l *Layer) Cartons() (defines []string, modifies []string) {
+
+	for name, c := range inventory {
+		if from := c.From(); len(from) > 0 && layerOf(from[0]) == l {
+			defines = append(defines, name)
+		}
+	}
+
+	updatesM.Lock()
+	seen := map[string]bool{}
+	for _, u := range updates {
+		if !seen[u.name] && layerOf(u.file) == l {
+			seen[u.name] = true
+			modifies = append(modifies, u.name)
+		}
+	}
+	updatesM.Unlock()
+	sort.Strings(defines)
+	sort.Strings(modifies)
+	return
+}
+
+func (l *Layer) String() string {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: priority %d", l.name, l.Priority)
+	if l.Desc != "" {
+		fmt.Fprintf(&b, ", %s", l.Desc)
+	}
+	fmt.Fprintf(&b, "\n     Dir: %s\n", l.dir)
+	if len(l.Compat) > 0 {
+		fmt.Fprintf(&b, "  Compat: %s\n", strings.Join(l.Compat, " "))
+	}
+	if len(l.Depends) > 0 {
+		fmt.Fprintf(&b, " Depends: %s\n", strings.Join(l.Depends, " "))
+	}
+	return b.String()
+}
+
+// validateLayers checks each layer is compatible with LayerSeries and its
+// required layers exist
+func validateLayers() error {
+
+	for _, l := range Layers() {
+		compat := len(l.Compat) == 0
+		for _, s := range l.Compat {
+			compat = compat || s == LayerSeries
+		}
+		if !compat {
+			return fmt.Errorf("layer %s is compatible with series %s, but current is %s",
+				l.name, strings.Join(l.Compat, " "), LayerSeries)
+		}
+		for _, dep := range l.Depends {
+			if _, err := FindLayer(dep); err != nil {
+				return fmt.Errorf("layer %s depends on %s", l.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadLayer registers absolute layer directory @dir of declarative cartons
+// unless it is registered. layer is described by layer.toml in @dir:
+//
+//	name = "meta-foo"       # default is base name of dir
+//	description = "Cartons of foo"
+//	priority = 10
+//	compat = ["1"]          # refer to LayerSeries
+//	depends = ["meta-bar"]
+//
+// directory without layer.toml is layer of priority 0
+func loadLayer(dir string) error {
+
+	for _, l := range Layers() {
+		if l.dir == dir {
+			return nil
+		}
+	}
+
+	file := filepath.Join(dir, layerFile)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return newLayer(filepath.Base(dir), dir, nil)
+	}
+
+	doc, err := toml.ParseFile(file)
+	if err != nil {
+		return err
+	}
+	doc.Positions[""] = toml.Position{File: file}
+	d := &decoder{doc: doc}
+	root := doc.Root
+	d.keys(root, "", "name", "description", "priority", "compat", "depends")
+
+	name := filepath.Base(dir)
+	if s := d.str(root, "", "name"); s != nil {
+		name = *s
+	}
+	l := &Layer{
+		Desc:    d.strOr(root, "", "description"),
+		Compat:  d.strs(root, "", "compat"),
+		Depends: d.strs(root, "", "depends"),
+	}
+	if v, ok := root["priority"]; ok {
+		priority, ok := v.(int64)
+		if !ok {
+			d.errorf("priority", "expected integer, got %T", v)
+		}
+		l.Priority = int(priority)
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	return newLayer(name, dir, func(layer *Layer) {
+		layer.Desc, layer.Priority = l.Desc, l.Priority
+		layer.Compat, layer.Depends = l.Compat, l.Depends
+	})
+}
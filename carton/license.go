@@ -0,0 +1,172 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"skygo/runbook"
+	"skygo/utils"
+	"skygo/utils/log"
+)
+
+// licFile is one license file with checksum
+type licFile struct {
+	path       string // relative to SRC dir
+	begin, end int    // line range, 0 means the first or the last line
+	algo, sum  string // md5 or sha256
+}
+
+// parseLicFile parses license file @spec, refer to LicFiles
+func parseLicFile(spec string) (*licFile, error) {
+
+	fields := strings.Split(spec, ";")
+	lf := &licFile{path: strings.TrimSpace(fields[0])}
+	if lf.path == "" || filepath.IsAbs(lf.path) {
+		return nil, fmt.Errorf("license file %q: path must be relative to SRC dir", spec)
+	}
+
+	for _, f := range fields[1:] {
+		kv := strings.SplitN(strings.TrimSpace(f), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("license file %q: %q is not key=value", spec, f)
+		}
+		var err error
+		switch kv[0] {
+		case "beginline":
+			lf.begin, err = strconv.Atoi(kv[1])
+		case "endline":
+			lf.end, err = strconv.Atoi(kv[1])
+		case "md5", "sha256":
+			lf.algo, lf.sum = kv[0], strings.ToLower(kv[1])
+		default:
+			err = fmt.Errorf("unknown key %s", kv[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("license file %q: %s", spec, err)
+		}
+	}
+
+	if lf.sum == "" {
+		return nil, fmt.Errorf("license file %q: md5 or sha256 is required", spec)
+	}
+	if lf.begin < 0 || lf.end < 0 || (lf.end > 0 && lf.end < lf.begin) {
+		return nil, fmt.Errorf("license file %q: invalid line range", spec)
+	}
+	return lf, nil
+}
+
+// checksum calculates checksum of lines in range under directory @src
+func (lf *licFile) checksum(src string) (string, error) {
+
+	data, err := ioutil.ReadFile(filepath.Join(src, lf.path))
+	if err != nil {
+		return "", err
+	}
+
+	if lf.begin > 0 || lf.end > 0 {
+		var b bytes.Buffer
+		s := bufio.NewScanner(bytes.NewReader(data))
+		s.Buffer(nil, len(data)+1)
+		for n := 1; s.Scan(); n++ {
+			if n >= lf.begin && (lf.end == 0 || n <= lf.end) {
+				b.Write(s.Bytes())
+				b.WriteByte('\n')
+			}
+		}
+		data = b.Bytes()
+	}
+
+	var h hash.Hash = sha256.New()
+	if lf.algo == "md5" {
+		h = md5.New()
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LicFiles adds license files @spec, returns all license files. format:
+//
+//	<path>[;beginline=<n>][;endline=<n>];md5=<hex>|sha256=<hex>
+//
+// path is relative to SRC dir. line range is inclusive and starts from 1.
+// checksums are verified after fetching, so relicensing upstream breaks the
+// build. verified license files are copied to WORKDIR/licenses and collected
+// by images
+func (c *Carton) LicFiles(spec ...string) []string {
+
+	c.licFiles = append(c.licFiles, spec...)
+	return c.licFiles
+}
+
+// licenseDir returns where license texts are copied, it's empty if carton
+// has no license files @licFiles
+func licenseDir(ctx runbook.Context, licFiles []string) string {
+
+	if len(licFiles) == 0 {
+		return ""
+	}
+	return filepath.Join(ctx.GetStr("WORKDIR"), "licenses")
+}
+
+// verifyLicenses verifies checksums of license files under SRC dir and copies
+// them to WORKDIR/licenses
+func (c *Carton) verifyLicenses(ctx runbook.Context) error {
+
+	dir := licenseDir(ctx, c.licFiles)
+	if dir == "" {
+		return nil
+	}
+	if c.License == "" {
+		log.Warning("%s has license files but no license", c.name)
+	}
+
+	src, _ := ctx.Dir()
+	os.RemoveAll(dir)
+
+	mismatched := []string{}
+	for _, spec := range c.licFiles {
+		lf, err := parseLicFile(spec)
+		if err != nil {
+			return err
+		}
+		sum, err := lf.checksum(src)
+		if err != nil {
+			return fmt.Errorf("license file of %s: %s", c.name, err)
+		}
+		if sum != lf.sum {
+			mismatched = append(mismatched, fmt.Sprintf("%s: %s expected %s, got %s",
+				lf.path, lf.algo, lf.sum, sum))
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(src, lf.path))
+		if err != nil {
+			return err
+		}
+		err = utils.CopyFile(filepath.Join(dir, lf.path), 0644, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(mismatched) > 0 {
+		return fmt.Errorf("license files of %s are changed, review license and update checksums:\n\t%s",
+			c.name, strings.Join(mismatched, "\n\t"))
+	}
+	return nil
+}
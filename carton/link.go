@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"runtime"
 	"skygo/fetch"
+	"skygo/pkg"
 	"skygo/runbook"
 	"strings"
 )
@@ -27,7 +28,10 @@ func (l *link) SrcDir(wd string) string             { return l.h.SrcDir(wd) }
 func (l *link) FilesPath() []string                 { return l.h.FilesPath() }
 func (l *link) BuildDepends(dep ...string) []string { return l.h.BuildDepends() }
 func (l *link) Depends(dep ...string) []string      { return l.h.Depends() }
+func (l *link) Variants(name ...string) []string    { return l.h.Variants() }
 func (l *link) Runbook() *runbook.Runbook           { return l.h.Runbook() }
+func (l *link) Packager() pkg.Packager              { return l.h.Packager() }
+func (l *link) Overrides() []runbook.Override       { return l.h.Overrides() }
 func (l *link) String() string                      { return l.h.String() }
 
 // Get retrieves the value of the variable named by the key.
@@ -59,6 +63,11 @@ func (c *Carton) Provide(provider ...string) {
 
 		panic(fmt.Errorf("%s: must add provider in init func", file))
 	}
+	c.provide(file, provider...)
+}
+
+// provide create link to provider, @file describes the link
+func (c *Carton) provide(file string, provider ...string) {
 
 	for _, name := range provider {
 
@@ -0,0 +1,285 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Problem is one mistake found by Lint
+type Problem struct {
+	Carton  string `json:"carton,omitempty"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Check   string `json:"check"` // which check finds it, e.g. depends
+	Message string `json:"message"`
+}
+
+func (p *Problem) String() string {
+
+	var b strings.Builder
+	if p.File != "" {
+		b.WriteString(p.File)
+		if p.Line > 0 {
+			fmt.Fprintf(&b, ":%d", p.Line)
+		}
+		b.WriteString(": ")
+	}
+	if p.Carton != "" {
+		fmt.Fprintf(&b, "%s: ", p.Carton)
+	}
+	fmt.Fprintf(&b, "%s [%s]", p.Message, p.Check)
+	return b.String()
+}
+
+// newProblem creates problem of carton @b, which is located by where carton
+// is described
+func newProblem(b Builder, check, msg string) Problem {
+
+	p := Problem{Carton: b.Provider(), Check: check, Message: msg}
+	if from := b.From(); len(from) > 0 {
+		p.File = from[0]
+	}
+	if m, ok := inventory[b.Provider()].(Modifier); ok {
+		p.Line = toCarton(m).line
+	}
+	return p
+}
+
+// sha256 checksum of http(s) source URL
+var checksumRe = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// stages which may have no task, load adds tasks to sysroot and patch
+var optionalStages = map[string]bool{SYSROOT: true, PATCH: true, PREPARE: true}
+
+// Lint builds inventory like BuildInventory, but reports all problems found
+// instead of the first error, sorted by file and line:
+//
+//	layer: layer is incompatible or requires missing layer
+//	depends: dependency is not found, ambiguous, unsatisfied, in a loop or
+//	         doesn't support variant which it resolves to
+//	variant: carton supports unknown variant
+//	version: pattern of ForVersion matches no version of carton
+//	provide: name is provided twice, or by several cartons without
+//	         preferred provider
+//	srcurl: http(s) URL has no sha256 checksum, file:// URL is not found
+//	         under FilesPath
+//	filespath: directory given to AddFilePath doesn't exist
+//	override: qualifier of override is unknown, or names unknown variant
+//	script: task script file *.sh is not found under FilesPath
+//	stage: stage has no task, but it's not disabled
+func Lint(ctx context.Context) []Problem {
+
+	problems := []Problem{}
+	if err := validateLayers(); err != nil {
+		problems = append(problems, Problem{Check: "layer", Message: err.Error()})
+	}
+
+	buildInventory()
+
+	names := make([]string, 0, len(inventory))
+	for name := range inventory {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	depOK := true
+	for _, name := range names {
+		c := inventory[name]
+		// the same problem may be found by several variants
+		found := map[string]bool{}
+		for _, v := range variantsOf(c) {
+			for _, spec := range append(c.BuildDepends(), c.Depends()...) {
+				if err := validateDepend(v, spec); err != nil && !found[err.Error()] {
+					depOK = false
+					found[err.Error()] = true
+					problems = append(problems, newProblem(c, "depends", err.Error()))
+				}
+			}
+		}
+		problems = append(problems, lintCarton(c)...)
+	}
+	problems = append(problems, lintProviders()...)
+
+	// loop is reported once by the carton which finds it firstly
+	if depOK {
+		loops := map[string]bool{}
+		for _, name := range names {
+			if err := hasLoopDep(ctx, name); err != nil && !loops[err.Error()] {
+				loops[err.Error()] = true
+				problems = append(problems, newProblem(inventory[name], "depends", err.Error()))
+			}
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+// lintCarton checks source URLs, FilesPath and runbook of carton @b
+func lintCarton(b Builder) []Problem {
+
+	problems := []Problem{}
+	report := func(check, format string, v ...interface{}) {
+		problems = append(problems, newProblem(b, check, fmt.Sprintf(format, v...)))
+	}
+
+	filesPath := b.FilesPath()
+	inFilesPath := func(rel string) bool {
+		for _, dir := range filesPath {
+			if _, err := os.Stat(filepath.Join(dir, rel)); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, url := range b.Resource().URLs() {
+		switch {
+		case strings.HasPrefix(url, "file://"):
+			if !inFilesPath(strings.TrimPrefix(url, "file://")) {
+				report("srcurl", "%s is not found in FilesPath", url)
+			}
+		case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+			if i := strings.LastIndex(url, "#"); i < 0 || !checksumRe.MatchString(url[i+1:]) {
+				report("srcurl", "%s has no sha256 checksum, append it by #<sha256>", url)
+			}
+		}
+	}
+
+	if m, ok := b.(Modifier); ok {
+		problems = append(problems, toCarton(m).problems...)
+
+		versions := b.Resource().Versions()
+		for _, fv := range toCarton(m).forVersions {
+			matched := false
+			for _, ver := range versions {
+				ok, _ := path.Match(fv.pattern, ver)
+				matched = matched || ok
+			}
+			switch {
+			case matched:
+			case len(versions) == 0:
+				report("version", "ForVersion %s is never applied, carton has no version",
+					fv.pattern)
+			default:
+				report("version", "ForVersion %s matches no version, available: %s",
+					fv.pattern, strings.Join(versions, ", "))
+			}
+		}
+	}
+
+	for _, name := range b.Variants() {
+		if _, err := FindVariant(name); err != nil {
+			report("variant", "%s, candidates: %s", err, strings.Join(Variants(), ", "))
+		}
+	}
+	for _, o := range b.Overrides() {
+		for _, q := range strings.Fields(o.When) {
+			if !strings.HasPrefix(q, "variant:") {
+				continue
+			}
+			if _, err := FindVariant(strings.TrimPrefix(q, "variant:")); err != nil {
+				report("override", "%s of %s: %s, candidates: %s", o.Op, o.Key, err,
+					strings.Join(Variants(), ", "))
+			}
+		}
+	}
+
+	rb := b.Runbook()
+	if rb == nil {
+		return problems
+	}
+	script := func(where, s string) {
+		if !strings.Contains(s, "\n") && !strings.ContainsAny(s, " \t") &&
+			(strings.HasSuffix(s, ".sh") || strings.HasSuffix(s, ".bash")) &&
+			!inFilesPath(s) {
+			report("script", "%s: script %s is not found in FilesPath", where, s)
+		}
+	}
+	hasSrc := len(b.Resource().Versions()) > 0
+	for stage := rb.Head(); stage != nil; stage = stage.Next() {
+		for _, s := range stage.Scripts() {
+			script("stage "+stage.Name(), s)
+		}
+		if stage.Len() > 0 || stage.Disabled() || optionalStages[stage.Name()] {
+			continue
+		}
+		// carton without source, e.g. package group, builds nothing
+		if !hasSrc && (stage.Name() == BUILD || stage.Name() == INSTALL) {
+			continue
+		}
+		report("stage", "stage %s has no task, inherit class, add task or disable it",
+			stage.Name())
+	}
+	for _, name := range rb.TaskForces() {
+		for _, s := range rb.TaskForce(name).Scripts() {
+			script("task force "+name, s)
+		}
+	}
+	return problems
+}
+
+// lintProviders checks provided names of cartons
+func lintProviders() []Problem {
+
+	virtualMu.Lock()
+	targets := make([]string, 0, len(virtualInventory))
+	for target := range virtualInventory {
+		targets = append(targets, target)
+	}
+	virtualMu.Unlock()
+	sort.Strings(targets)
+
+	problems := []Problem{}
+	for _, target := range targets {
+
+		virtualMu.Lock()
+		candidates := append([]Builder{}, virtualInventory[target]...)
+		_, isPreferred := preferred[target]
+		_, isReal := inventory[target]
+		virtualMu.Unlock()
+
+		for _, c := range candidates {
+			count := 0
+			if m, ok := inventory[c.Provider()].(Modifier); ok {
+				for _, p := range toCarton(m).cartons[1:] {
+					if p == target {
+						count++
+					}
+				}
+			}
+
+			msg := ""
+			switch {
+			case count > 1:
+				msg = fmt.Sprintf("%s is provided %d times", target, count)
+			case isPreferred:
+			case isReal:
+				msg = fmt.Sprintf("%s is also a carton, select one by PREFERRED_PROVIDER_%s",
+					target, target)
+			case len(candidates) > 1:
+				msg = fmt.Sprintf("%s is provided by %s, select one by PREFERRED_PROVIDER_%s",
+					target, strings.Join(Providers(target), ", "), target)
+			}
+			if msg != "" {
+				problems = append(problems, newProblem(c, "provide", msg))
+			}
+		}
+	}
+	return problems
+}
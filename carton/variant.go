@@ -0,0 +1,273 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package carton
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"skygo/runbook"
+)
+
+// Variant is one kind of build of carton, e.g. native tools running on
+// building machine. carton is built once per variant, each one has its own
+// arch, os and vendor, WORKDIR, sysroot and overrides. carton name of variant
+// is carton name with prefix or suffix of variant, e.g. m4-native, lib32-zlib
+//
+// builtin variants are:
+//
+//	target     runs on target machine, no prefix or suffix
+//	native     runs on building machine, suffix -native
+//	nativesdk  runs on SDK host, which is described by SDKARCH, SDKOS and
+//	           SDKVENDOR, prefix nativesdk-
+//	cross      runs on building machine and generates code for target
+//	           machine, e.g. compiler, suffix -cross
+//	lib32      multilib of target machine, whose arch is MULTILIB_ARCH,
+//	           prefix lib32-
+//
+// KV overrides of variant are qualified by variant:<name>, refer to
+// runbook.KVOverrider
+type Variant struct {
+	Prefix string // prefix of carton name, e.g. lib32-
+	Suffix string // suffix of carton name, e.g. -native
+
+	// settings keys of arch, os and vendor which variant is built for, e.g.
+	// NATIVEARCH. empty one or empty value of settings falls back to target
+	// machine's, arch of target machine can be changed by carton's TARGETARCH
+	Arch, OS, Vendor string
+
+	// Host is true if variant is built by host tools and runs on building
+	// machine, it's staged into SYSROOT_NATIVE and isn't deployed
+	Host bool
+
+	// Deps is variant which dependencies without prefix or suffix of variant
+	// resolve to, default is variant itself
+	Deps string
+
+	// Vars are values of variant, carton's values win over them, and they
+	// win over global settings
+	Vars map[string]interface{}
+
+	name string
+}
+
+// name of builtin variant
+const (
+	TargetVariant    = "target"
+	NativeVariant    = "native"
+	NativeSDKVariant = "nativesdk"
+	CrossVariant     = "cross"
+	Lib32Variant     = "lib32"
+)
+
+var (
+	variants  = make(map[string]*Variant)
+	variantsM sync.Mutex
+)
+
+// target variant, carton without prefix or suffix of variant
+var target *Variant
+
+func init() {
+
+	NewVariant(TargetVariant, func(v *Variant) {
+		v.OS, v.Vendor = "MACHINEOS", "MACHINEVENDOR"
+	})
+	NewVariant(NativeVariant, func(v *Variant) {
+		v.Suffix = "-native"
+		v.Arch, v.OS, v.Vendor = "NATIVEARCH", "NATIVEOS", "NATIVEVENDOR"
+		v.Host = true
+	})
+	NewVariant(NativeSDKVariant, func(v *Variant) {
+		v.Prefix = "nativesdk-"
+		v.Arch, v.OS, v.Vendor = "SDKARCH", "SDKOS", "SDKVENDOR"
+	})
+	NewVariant(CrossVariant, func(v *Variant) {
+		v.Suffix = "-cross"
+		v.OS, v.Vendor = "MACHINEOS", "MACHINEVENDOR"
+		v.Host = true
+		v.Deps = NativeVariant
+	})
+	NewVariant(Lib32Variant, func(v *Variant) {
+		v.Prefix = "lib32-"
+		v.Arch, v.OS, v.Vendor = "MULTILIB_ARCH", "MACHINEOS", "MACHINEVENDOR"
+	})
+	target, _ = FindVariant(TargetVariant)
+}
+
+// NewVariant registers variant @name, which is configured by @m
+func NewVariant(name string, m func(v *Variant)) {
+
+	variantsM.Lock()
+	defer variantsM.Unlock()
+
+	if _, ok := variants[name]; ok {
+		panic(fmt.Sprintf("Carton Err: variant %s had been added", name))
+	}
+	v := &Variant{name: name}
+	if m != nil {
+		m(v)
+	}
+	if name != TargetVariant && v.Prefix == "" && v.Suffix == "" {
+		panic(fmt.Sprintf("Carton Err: variant %s has neither prefix nor suffix", name))
+	}
+	variants[name] = v
+}
+
+// FindVariant finds variant @name
+func FindVariant(name string) (*Variant, error) {
+
+	variantsM.Lock()
+	defer variantsM.Unlock()
+
+	if v, ok := variants[name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("variant %s is not found", name)
+}
+
+// Variants returns names of all variants, sorted by name
+func Variants() []string {
+
+	variantsM.Lock()
+	defer variantsM.Unlock()
+
+	names := make([]string, 0, len(variants))
+	for name := range variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name returns name of variant
+func (v *Variant) Name() string { return v.name }
+
+// Of returns carton name of variant, e.g. zlib-native
+func (v *Variant) Of(name string) string {
+	return v.Prefix + name + v.Suffix
+}
+
+// deps returns variant which dependencies resolve to
+func (v *Variant) deps() *Variant {
+
+	if v.Deps == "" {
+		return v
+	}
+	if d, err := FindVariant(v.Deps); err == nil {
+		return d
+	}
+	return v
+}
+
+func (v *Variant) String() string { return v.name }
+
+// ctxVariant returns variant which carton of @ctx is built for, it's target
+// if VARIANT isn't set
+func ctxVariant(ctx runbook.Context) *Variant {
+
+	if v, err := FindVariant(ctx.GetStr("VARIANT")); err == nil {
+		return v
+	}
+	return target
+}
+
+// splitVariant splits carton name @name into name without prefix or suffix of
+// variant and the variant. target variant is returned if @name has none.
+// variants are tried by length of prefix and suffix, longest first, and the
+// longest one wins if its prefix and suffix contain the ones of others which
+// match too, e.g. prefix lib32- wins over lib-, otherwise @name is ambiguous,
+// e.g. nativesdk-foo-native
+func splitVariant(name string) (string, *Variant, error) {
+
+	variantsM.Lock()
+	defer variantsM.Unlock()
+
+	matched := []*Variant{}
+	for _, v := range variants {
+		if v == target {
+			continue
+		}
+		if strings.HasPrefix(name, v.Prefix) && strings.HasSuffix(name, v.Suffix) &&
+			len(name) > len(v.Prefix)+len(v.Suffix) {
+			matched = append(matched, v)
+		}
+	}
+	if len(matched) == 0 {
+		return name, target, nil
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		li := len(matched[i].Prefix) + len(matched[i].Suffix)
+		lj := len(matched[j].Prefix) + len(matched[j].Suffix)
+		if li != lj {
+			return li > lj
+		}
+		return matched[i].name < matched[j].name
+	})
+
+	v := matched[0]
+	for _, o := range matched[1:] {
+		if !strings.HasPrefix(v.Prefix, o.Prefix) || !strings.HasSuffix(v.Suffix, o.Suffix) {
+			return name, nil, fmt.Errorf("carton name %s is ambiguous, it's both variant %s and %s",
+				name, v.name, o.name)
+		}
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(name, v.Prefix), v.Suffix), v, nil
+}
+
+// VariantError reports carton doesn't support variant
+type VariantError struct {
+	Carton    string
+	Variant   string
+	Supported []string
+}
+
+func (e *VariantError) Error() string {
+	return fmt.Sprintf("%s doesn't support variant %s, supported: %s",
+		e.Carton, e.Variant, strings.Join(e.Supported, ", "))
+}
+
+// supports returns error if carton @b doesn't support variant @v
+func supports(b Builder, v *Variant) error {
+
+	supported := append([]string{TargetVariant}, b.Variants()...)
+	for _, name := range supported {
+		if name == v.name {
+			return nil
+		}
+	}
+	return &VariantError{Carton: b.Provider(), Variant: v.name, Supported: supported}
+}
+
+// variantsOf returns variants supported by carton @b, target is the first
+func variantsOf(b Builder) []*Variant {
+
+	vs := []*Variant{target}
+	for _, name := range b.Variants() {
+		if v, err := FindVariant(name); err == nil && v != target {
+			vs = append(vs, v)
+		}
+	}
+	return vs
+}
+
+// Find finds carton @name required by carton of variant @v, e.g. its
+// dependency. @name without prefix or suffix of variant resolves to variant
+// Deps of @v, refer to Find for others
+func (v *Variant) Find(name string) (h Builder, isVirtual bool, variant *Variant, err error) {
+
+	h, isVirtual, variant, err = Find(name)
+	if err != nil || variant != target || v.deps() == target {
+		return
+	}
+	variant = v.deps()
+	if err = supports(h, variant); err != nil {
+		return nil, isVirtual, variant, err
+	}
+	return
+}
@@ -36,6 +36,13 @@ type SrcURL struct {
 	head *list.List
 }
 
+// Source describes one source URL with what is resolved after fetching
+type Source struct {
+	URL      string `json:"url"`
+	Checksum string `json:"sha256,omitempty"`   // checksum of http(s) archive
+	Revision string `json:"revision,omitempty"` // revision of vcs repository
+}
+
 type fetchCmd struct {
 	fetch func(ctx runbook.Context, from string, notify func(bool)) error
 	url   string
@@ -141,6 +148,46 @@ func (fetch *Resource) Selected() (*SrcURL, string) {
 	return nil, ""
 }
 
+// URLs returns source URLs of all versions, sorted by version from latest
+func (fetch *Resource) URLs() []string {
+
+	urls := []string{}
+	for _, ver := range fetch.Versions() {
+		res := fetch.resource[ver]
+		for e := res.head.Front(); e != nil; e = e.Next() {
+			urls = append(urls, strings.TrimSpace(e.Value.(*fetchCmd).url))
+		}
+	}
+	return urls
+}
+
+// Sources returns source URLs of selected version, revision of vcs repository
+// is resolved under WORKDIR, checksum of http(s) archive is the one in URL
+func (fetch *Resource) Sources(ctx runbook.Context) []Source {
+
+	sources := []Source{}
+	res, _ := fetch.Selected()
+	if res == nil {
+		return sources
+	}
+
+	for e := res.head.Front(); e != nil; e = e.Next() {
+		url := strings.TrimSpace(e.Value.(*fetchCmd).url)
+		src := Source{URL: url}
+		switch {
+		case strings.HasPrefix(url, "file://"):
+		case bySuffix(url) != nil:
+			src.Revision = revision(ctx.GetStr("WORKDIR"), url)
+		default:
+			if i := strings.LastIndex(url, "#"); i >= 0 {
+				src.URL, src.Checksum = url[:i], url[i+1:]
+			}
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
 // Download download all source URL held by selected SrcURL
 // Extract automatically if source URL is an archiver, like tar.bz2
 // if source code is updated, it calls notify
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -120,20 +121,46 @@ func (vcs *vcsCmd) run(ctx runbook.Context, dir, cmdline string) ([]byte, error)
 	return buf.Bytes(), nil
 }
 
-// look up repo, if not found, create it
-func (vcs *vcsCmd) lookupRepo(ctx runbook.Context) error {
+// repoDir returns where repository @repo is cloned under @wd
+func repoDir(wd, repo, index string) string {
 
-	path := vcs.repo
-	if i := strings.Index(vcs.repo, "//"); i >= 0 {
-		path = vcs.repo[i+2:] // skip //
+	path := repo
+	if i := strings.Index(repo, "//"); i >= 0 {
+		path = repo[i+2:] // skip //
 	}
 
-	if i := strings.Index(path, vcs.index); i >= 0 {
+	if i := strings.Index(path, index); i >= 0 {
 		path = path[:i]
 	}
+	return filepath.Join(wd, filepath.Base(path))
+}
+
+// revision returns revision checked out in repository @url under @wd
+// empty string is returned if it's not fetched
+func revision(wd, url string) string {
+
+	repo := url
+	if i := strings.LastIndex(url, "@"); i >= 0 {
+		repo = url[:i]
+	}
+	vcs := bySuffix(url)
+	if vcs == nil {
+		return ""
+	}
+
+	cmd := exec.Command(vcs.cmd, strings.Fields(vcs.revCmd)...)
+	cmd.Dir = repoDir(wd, repo, vcs.index)
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// look up repo, if not found, create it
+func (vcs *vcsCmd) lookupRepo(ctx runbook.Context) error {
 
-	wd := ctx.GetStr("WORKDIR")
-	vcs.dir = filepath.Join(wd, filepath.Base(path))
+	vcs.dir = repoDir(ctx.GetStr("WORKDIR"), vcs.repo, vcs.index)
 	index := filepath.Join(vcs.dir, vcs.index)
 	dir := filepath.Dir(vcs.dir)
 
@@ -20,18 +20,48 @@ const (
 	BASEWKDIR = "BASEWKDIR"
 
 	IMAGEDIR = "IMAGEDIR"
+	FEEDDIR  = "FEEDDIR"
+
+	PKGDATADIR = "PKGDATADIR"
+
+	LAYERS = "LAYERS" // directories of declarative cartons
+
+	// prefix of setting to select provider of virtual carton, e.g.
+	// PREFERRED_PROVIDER_virtual/kernel
+	PREFERRED_PROVIDER = "PREFERRED_PROVIDER_"
+
+	// distro features with delimiter space, e.g. "systemd ipv6"
+	DISTRO_FEATURES = "DISTRO_FEATURES"
+
+	// licenses refused by images with delimiter space, e.g. "GPL-3.0* AGPL-*"
+	INCOMPATIBLE_LICENSES = "INCOMPATIBLE_LICENSES"
 
 	// native/building machine's attributes
 	NATIVEARCH   = "NATIVEARCH"
 	NATIVEOS     = "NATIVEOS"
 	NATIVEVENDOR = "NATIVEVENDOR"
 
+	// attributes of SDK host, where variant nativesdk runs
+	SDKARCH   = "SDKARCH"
+	SDKOS     = "SDKOS"
+	SDKVENDOR = "SDKVENDOR"
+
+	// arch of variant lib32, multilib of target machine
+	MULTILIB_ARCH = "MULTILIB_ARCH"
+
 	// target machine's attributes
 	MACHINE       = "MACHINE"
 	MACHINEARCH   = "MACHINEARCH"
 	MACHINEOS     = "MACHINEOS"
 	MACHINEVENDOR = "MACHINEVENDOR"
 
+	// attributes of selected machine, refer to package machine
+	TUNE_CCARGS      = "TUNE_CCARGS"
+	MACHINE_FEATURES = "MACHINE_FEATURES"
+	KERNEL_IMAGETYPE = "KERNEL_IMAGETYPE"
+	SERIAL_CONSOLES  = "SERIAL_CONSOLES"
+	IMAGE_FSTYPES    = "IMAGE_FSTYPES"
+
 	// their value are calcaulated dynamically
 	TARGETARCH   = "TARGETARCH"
 	TARGETOS     = "TARGETOS"
@@ -46,9 +76,17 @@ var defaultVars = map[string]interface{}{
 	NATIVEOS:     runtime.GOOS,
 	NATIVEVENDOR: "",
 
-	MACHINEOS:     "linux",
-	MACHINEARCH:   "",
-	MACHINEVENDOR: "",
+	SDKARCH:   runtime.GOARCH,
+	SDKOS:     runtime.GOOS,
+	SDKVENDOR: "",
+
+	MULTILIB_ARCH: "",
+
+	LAYERS: "",
+
+	DISTRO_FEATURES: "",
+
+	INCOMPATIBLE_LICENSES: "",
 
 	TIMEOUT:    600, // unit is second, default is 10min
 	MAXLOADERS: 2 * runtime.NumCPU(),
@@ -56,8 +94,11 @@ var defaultVars = map[string]interface{}{
 
 var settings *runbook.KV
 
+// getVar returns setting @key, machine's attributes are empty until they are
+// assigned by selectMachine
 func getVar(key string) string {
-	return defaultVars[key].(string)
+	v, _ := defaultVars[key].(string)
+	return v
 }
 
 func init() {
@@ -80,6 +121,13 @@ func init() {
 	image := filepath.Join(tmp, "deploy", "image")
 	defaultVars[IMAGEDIR] = image
 
+	// default: build/tmp/deploy/ipk
+	feed := filepath.Join(tmp, "deploy", "ipk")
+	defaultVars[FEEDDIR] = feed
+
+	// default: build/tmp/pkgdata
+	defaultVars[PKGDATADIR] = filepath.Join(tmp, "pkgdata")
+
 	// default: build/downloads
 	dl := filepath.Join(build, "downloads")
 	defaultVars[DLDIR] = dl
@@ -97,15 +145,42 @@ func init() {
 //  TMPDIR: default is BUILDIR/tmp
 //  BASEWKDIR: default value is TMPDIR/work
 //  IMAGEDIR: where to store final images. default value is TMPDIR/deploy/image
-//  MACHINE: it should be configed outside
+//  FEEDDIR: where to store package archives, one sub directory per arch.
+//           default value is TMPDIR/deploy/ipk
+//  PKGDATADIR: where to share package data across cartons, one sub directory
+//           per TARGETSYS. default value is TMPDIR/pkgdata
+//  LAYERS: directories with delimiter space to discover declarative cartons
+//          *.carton.toml and *.append.toml. each one is a layer, which
+//          can be described by layer.toml, refer to carton.Layer
+//  PREFERRED_PROVIDER_<name>: which carton provides virtual carton <name>
+//          when several cartons provide it
+//  DISTRO_FEATURES: features with delimiter space, they are qualifiers of
+//          overrides, refer to runbook.KVOverrider
+//  INCOMPATIBLE_LICENSES: license globs with delimiter space, image refuses
+//          packages which can't be used without them. image can override it
+//  SDKARCH: arch of SDK host where variant nativesdk runs, default is NATIVEARCH
+//  SDKOS: default is NATIVEOS
+//  SDKVENDOR: default is NATIVEVENDOR
+//  MULTILIB_ARCH: arch of variant lib32, default is MACHINEARCH
+//  MACHINE: it should be configed outside. if it names machine registered by
+//          machine.NewMachine, the following are populated from machine
 //  MACHINEARCH:  it should be configed outside
 //  MACHINEOS: default value is linux
 //  MACHINEVENDOR: it should be configed outside
+//  TUNE_CCARGS: CPU tuning flags for compiler
+//  MACHINE_FEATURES: machine features with delimiter space
+//  KERNEL_IMAGETYPE: kernel image type, e.g. zImage
+//  SERIAL_CONSOLES: serial consoles with delimiter space, e.g. 115200;ttyS0
+//  IMAGE_FSTYPES: image formats with delimiter space, e.g. tar.gz ext4
 //  TARGETARCH: ARCH for specific carton
 //  TARGETOS: OS for specific carton
 //  TARGETVENDOR: vendor for specific carton
+//  VARIANT: variant of specific carton, e.g. native, refer to carton.Variant
 //  TIMEOUT: timeout to build carton. default value is 1800. unit is second
 //
+// Settings().Override, Append and Prepend assign value conditionally, they
+// are resolved for each carton before carton's overrides
+//
 func Settings() *runbook.KV {
 	return settings
 }
@@ -21,11 +21,14 @@ import (
 )
 
 type _context struct {
-	load   *Load
-	carton carton.Builder
-	kv     runbook.KV
-	pool   *pool
-	stage  string // running at which stage
+	load    *Load
+	carton  carton.Builder
+	variant *carton.Variant
+	kv      runbook.KV
+	pool    *pool
+	stage   string // running at which stage
+
+	overrides map[string][]string // key -> overrides which take effect
 }
 
 func getCartonFromCtx(ctx runbook.Context) carton.Builder {
@@ -38,39 +41,84 @@ func getLoadFromCtx(ctx runbook.Context) *Load {
 	return ctx.(*_context).load
 }
 
+func getVariantFromCtx(ctx runbook.Context) *carton.Variant {
+
+	return ctx.(*_context).variant
+}
+
 // set which stage is currently running
 func setStageToCtx(ctx runbook.Context, name string) {
 	ctx.(*_context).stage = name
 }
 
 func newContext(load *Load, carton carton.Builder,
-	isNative bool) *_context {
+	v *carton.Variant) *_context {
 
 	ctx := &_context{
-		load:   load,
-		carton: carton,
+		load:    load,
+		carton:  carton,
+		variant: v,
 	}
 
-	workDir := workDir(carton, isNative)
+	workDir := workDir(carton, v)
 
 	// key-value for each carton's context
 	ctx.kv.Init2("context", map[string]interface{}{
 		"WORKDIR":  workDir,
-		"ISNATIVE": isNative,
+		"VARIANT":  v.Name(),
+		"ISNATIVE": v.Host, // built by host tools, e.g. native and cross
 
 		"PN":   carton.Provider(), // PN: provider name
 		"T":    filepath.Join(workDir, "temp"),
 		"D":    filepath.Join(workDir, "image"),    // install destination directory
 		"PKGD": filepath.Join(workDir, "packages"), // points to directory for files to be packaged
 
-		"TARGETARCH":   getTargetArch(carton, isNative),
-		"TARGETOS":     getTargetOS(carton, isNative),
-		"TARGETVENDOR": getTargetVendor(carton, isNative),
+		"TARGETARCH":   getTargetArch(carton, v),
+		"TARGETOS":     getTargetOS(carton, v),
+		"TARGETVENDOR": getTargetVendor(carton, v),
 	})
 
+	sys := targetSys(carton, v)
+	ctx.kv.Set("TARGETSYS", sys)
+
+	// carton's values win over variant's
+	for key, value := range v.Vars {
+		if carton.Get(key) == nil {
+			ctx.kv.Set(key, value)
+		}
+	}
+
+	// CROSS_COMPILE is prefix of toolchain utilities, e.g. arm-linux-gcc
+	// carton or global settings can assign it explicitily
+	if carton.Get("CROSS_COMPILE") == nil && load.kv.Get("CROSS_COMPILE") == nil {
+		if v.Host {
+			ctx.kv.Set("CROSS_COMPILE", "")
+		} else {
+			ctx.kv.Set("CROSS_COMPILE", sys+"-")
+		}
+	}
+
+	// dependencies are staged into SYSROOT, dependencies of host variant,
+	// e.g. native, are staged into SYSROOT_NATIVE
+	sysroot := filepath.Join(workDir, "sysroot")
+	ctx.kv.Set("SYSROOT_NATIVE", sysroot+"-native")
+	if v.Host {
+		sysroot += "-native"
+	}
+	ctx.kv.Set("SYSROOT", sysroot)
+
+	// pkg-config looks up .pc files in SYSROOT and prepends SYSROOT to paths
+	if carton.Get("PKG_CONFIG_SYSROOT_DIR") == nil && load.kv.Get("PKG_CONFIG_SYSROOT_DIR") == nil {
+		ctx.kv.Set("PKG_CONFIG_SYSROOT_DIR", sysroot)
+		ctx.kv.Set("PKG_CONFIG_LIBDIR", filepath.Join(sysroot, "usr/lib/pkgconfig")+
+			":"+filepath.Join(sysroot, "usr/share/pkgconfig"))
+	}
+
 	if dir := carton.SrcDir(workDir); dir != "" {
 		ctx.kv.Set("S", dir)
 	}
+
+	ctx.resolveOverrides()
 	return ctx
 }
 
@@ -96,7 +144,7 @@ func (ctx *_context) FilesPath() []string {
 
 func (ctx *_context) Wait(upper runbook.Context, runbook, stage string,
 	notifier runbook.Notifer) <-chan struct{} {
-	return ctx.load.wait(runbook, stage, upper.Get("ISNATIVE").(bool), notifier)
+	return ctx.load.wait(runbook, stage, getVariantFromCtx(upper), notifier)
 }
 
 func (ctx *_context) Output() (stdout, stderr io.Writer) {
@@ -107,7 +155,7 @@ func (ctx *_context) Output() (stdout, stderr io.Writer) {
 		return
 	}
 
-	s := ctx.load.getStage(ctx.carton.Provider(), ctx.stage, ctx.Get("ISNATIVE").(bool))
+	s := ctx.load.getStage(ctx.carton.Provider(), ctx.stage, ctx.variant)
 
 	_stdout, _stderr := s.getIO()
 
@@ -225,8 +273,7 @@ func (ctx *_context) Staged(name string) bool {
 
 	runbook := ctx.carton.Provider()
 
-	if ok := ctx.load.isStageLoaded(runbook, name,
-		ctx.Get("ISNATIVE").(bool)); ok {
+	if ok := ctx.load.isStageLoaded(runbook, name, ctx.variant); ok {
 		return true
 	}
 
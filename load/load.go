@@ -72,6 +72,34 @@ func (l *loadError) Error() string {
 	return str.String()
 }
 
+// loadCartons selects machine, loads layers and preferred providers by
+// settings @kv, inventory is built later
+func loadCartons(kv *runbook.KV) error {
+
+	selectMachine(kv)
+
+	if err := carton.LoadLayers(strings.Fields(kv.GetStr(LAYERS))...); err != nil {
+		return err
+	}
+
+	kv.Range(func(key, value string) {
+		if strings.HasPrefix(key, PREFERRED_PROVIDER) {
+			carton.PreferredProvider(strings.TrimPrefix(key, PREFERRED_PROVIDER), value)
+		}
+	})
+	return nil
+}
+
+// Lint loads cartons like NewLoad, and reports all problems of them instead
+// of exiting at the first error, refer to carton.Lint
+func Lint(ctx context.Context) []carton.Problem {
+
+	if err := loadCartons(Settings()); err != nil {
+		return []carton.Problem{{Check: "layer", Message: err.Error()}}
+	}
+	return carton.Lint(ctx)
+}
+
 // NewLoad create load to build carton
 // loaders represent how many loader work. if its value is 0, it will use default value
 // Such as BUILDIR can be changed by Settings().Set(key, value) before invoking NewLoad
@@ -98,6 +126,11 @@ func NewLoad(ctx context.Context, name string) (*Load, int) {
 		os.Exit(1)
 	}
 
+	if err := loadCartons(kv); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	if err := carton.BuildInventory(ctx); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -141,6 +174,7 @@ func NewLoad(ctx context.Context, name string) (*Load, int) {
 
 	os.MkdirAll(kv.GetStr(DLDIR), 0755)
 	os.MkdirAll(kv.GetStr(IMAGEDIR), 0755)
+	os.MkdirAll(kv.GetStr(FEEDDIR), 0755)
 	return &load, loaders
 }
 
@@ -190,7 +224,7 @@ func (l *Load) perform(ctx *_context, target string) {
 	log.Info("Carton %s is built successfully!", carton)
 }
 
-// shared for native and cross type
+// shared for all variants
 func (l *Load) setupRunbook(c carton.Builder) {
 
 	rb := c.Runbook()
@@ -217,10 +251,16 @@ func (l *Load) setupRunbook(c carton.Builder) {
 	registerNotifier(rb)
 }
 
-func (l *Load) find(name string) (c carton.Builder, isVirtual bool,
-	isNative bool, err error) {
+// find finds carton @name required by carton of variant @v, refer to
+// carton.Variant.Find. @v is nil if it's required by user
+func (l *Load) find(name string, v *carton.Variant) (c carton.Builder, isVirtual bool,
+	variant *carton.Variant, err error) {
 
-	c, isVirtual, isNative, err = carton.Find(name)
+	if v == nil {
+		c, isVirtual, variant, err = carton.Find(name)
+	} else {
+		c, isVirtual, variant, err = v.Find(name)
+	}
 	if err != nil {
 		l.once.Do(func() {
 			l.err = loadError{
@@ -241,7 +281,7 @@ func (l *Load) find(name string) (c carton.Builder, isVirtual bool,
 
 	name = t.Provider()
 	if !l.isRunbookLoaded(name) {
-		if _, ok := l.loadOrStoreRunbook(name, isNative); !ok {
+		if _, ok := l.loadOrStoreRunbook(name, variant); !ok {
 
 			log.Trace("Setup runbook for %s", name)
 			l.setupRunbook(t)
@@ -255,31 +295,47 @@ func (l *Load) Info(carton string,
 
 	defer l.exit()
 
-	c, virtual, native, err := l.find(carton)
+	c, virtual, variant, err := l.find(carton, nil)
 	if err != nil {
 		return &l.err
 	}
 
-	ctx := newContext(l, c, native)
+	ctx := newContext(l, c, variant)
 	info(ctx, c, virtual)
 	return nil
 }
 
-func (l *Load) wait(runbook, stage string, isNative bool,
-	notifier runbook.Notifer) <-chan struct{} {
+// Graph builds dependency graph of @cartons, refer to carton.NewGraph
+func (l *Load) Graph(cartons []string, depth int, stages bool) (*carton.Graph, error) {
+
+	defer l.exit()
+	return carton.NewGraph(cartons, depth, stages)
+}
+
+// Layers returns all layers when cartons are loaded, refer to carton.Layers
+func (l *Load) Layers() []*carton.Layer {
 
-	c, _, native, _ := l.find(runbook)
+	defer l.exit()
+	return carton.Layers()
+}
+
+// wait waits on @stage of @runbook required by carton of variant @v
+func (l *Load) wait(runbook, stage string, v *carton.Variant,
+	notifier runbook.Notifer) <-chan struct{} {
 
-	// inherits isNative
-	if native {
-		isNative = true
+	c, _, variant, err := l.find(runbook, v)
+	if err != nil {
+		// load is canceled by find
+		done := make(chan struct{})
+		close(done)
+		return done
 	}
 
 	carton := c.Provider()
-	state, ok := l.loadOrStoreRunbook(carton, isNative)
+	state, ok := l.loadOrStoreRunbook(carton, variant)
 	if !ok || state.getCtx() == nil {
 
-		ctx := newContext(l, c, isNative)
+		ctx := newContext(l, c, variant)
 		state.setCtx(ctx)
 
 		l.refGet()
@@ -299,20 +355,48 @@ func (l *Load) wait(runbook, stage string, isNative bool,
 
 func (l *Load) run(ctx *_context) {
 
-	isNative := ctx.kv.Get("ISNATIVE").(bool)
+	v := ctx.variant
+
+	wait := func(deps []string) error {
+		for _, spec := range deps {
 
-	wait := func(deps []string) {
-		for _, carton := range deps {
+			d, err := carton.ParseDependency(spec)
+			if err != nil {
+				return err
+			}
+			c, _, _, err := v.Find(d.Carton())
+			if err == carton.ErrNotFound && d.Optional {
+				log.Trace("Skip optional dependency %s", spec)
+				continue
+			}
 
-			<-l.wait(carton, "", isNative, nil)
+			// version is selected when runbook of dependency is loaded
+			<-l.wait(d.Carton(), d.Stage, v, nil)
+			if err == nil {
+				if _, ver := c.Resource().Selected(); !d.Satisfy(ver) {
+					return fmt.Errorf("dependency %s is not satisfied by %s %s",
+						spec, c.Provider(), ver)
+				}
+			}
 		}
+		return nil
 	}
 
 	c := ctx.carton
 	if nodeps := ctx.kv.Get("_nodeps"); nodeps == nil {
 
-		wait(c.BuildDepends())
-		wait(c.Depends())
+		for _, deps := range [][]string{c.BuildDepends(), c.Depends()} {
+			if err := wait(deps); err != nil {
+				l.once.Do(func() {
+					l.err = loadError{
+						carton: c.Provider(),
+						err:    err,
+					}
+					l.cancel()
+				})
+				return
+			}
+		}
 	}
 
 	l.perform(ctx, ctx.kv.GetStr("_target"))
@@ -320,13 +404,13 @@ func (l *Load) run(ctx *_context) {
 
 func (l *Load) start(carton, target string, nodeps, force bool) {
 
-	c, _, isNative, err := l.find(carton)
+	c, _, variant, err := l.find(carton, nil)
 	if err != nil {
 		return
 	}
 
 	if force {
-		t := tempDir(c, isNative)
+		t := tempDir(c, variant)
 		cleanstate1(c, target, t)
 	}
 
@@ -335,9 +419,9 @@ func (l *Load) start(carton, target string, nodeps, force bool) {
 		nodeps = true
 	}
 
-	state, ok := l.loadOrStoreRunbook(c.Provider(), isNative)
+	state, ok := l.loadOrStoreRunbook(c.Provider(), variant)
 	if !ok || state.getCtx() == nil {
-		ctx := newContext(l, c, isNative)
+		ctx := newContext(l, c, variant)
 		state.setCtx(ctx)
 
 		if nodeps {
@@ -377,6 +461,6 @@ func (l *Load) Run(nodeps, force bool, cartons ...string) error {
 	return nil
 }
 
-func (l *Load) markStageDone(runbook, stage string, isNative bool) {
-	l.setStageDone(runbook, stage, isNative)
+func (l *Load) markStageDone(runbook, stage string, v *carton.Variant) {
+	l.setStageDone(runbook, stage, v)
 }
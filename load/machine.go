@@ -0,0 +1,72 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package load
+
+import (
+	"strings"
+
+	"skygo/machine"
+	"skygo/runbook"
+	"skygo/utils/log"
+)
+
+// machineDefaults are default values of machine's attributes. they aren't
+// in defaultVars, so keys found in settings are configured explicitly
+var machineDefaults = map[string]string{
+	MACHINEARCH:   "",
+	MACHINEVENDOR: "",
+	MACHINEOS:     "linux",
+}
+
+// selectMachine populates settings @kv from machine named by MACHINE
+// machine's attributes, including arch, vendor and os, are assigned only if
+// they are not configured explicitly, then machineDefaults are assigned to
+// the ones still not set
+// it's fine that MACHINE doesn't name registered machine, MACHINEARCH etc.
+// are configured outside then
+func selectMachine(kv *runbook.KV) {
+
+	setDefault := func(key string, value interface{}) {
+		if v, ok := value.(string); ok && v == "" {
+			return
+		}
+		if _, ok := kv.Lookup(key); !ok {
+			kv.Set(key, value)
+		}
+	}
+	defer func() {
+		for key, value := range machineDefaults {
+			if _, ok := kv.Lookup(key); !ok {
+				kv.Set(key, value)
+			}
+		}
+	}()
+
+	name := kv.GetStr(MACHINE)
+	if name == "" {
+		return
+	}
+	m, err := machine.Find(name)
+	if err != nil {
+		log.Trace("%s, it's configured outside", err)
+		return
+	}
+	log.Trace("Select machine %s described by %s", name, m.From())
+
+	setDefault(MACHINEARCH, m.Arch)
+	setDefault(MACHINEVENDOR, m.Vendor)
+	setDefault(MACHINEOS, m.OS)
+	setDefault(TUNE_CCARGS, strings.Join(m.Tune, " "))
+	setDefault(MACHINE_FEATURES, strings.Join(m.Features, " "))
+	setDefault(KERNEL_IMAGETYPE, m.KernelImage)
+	setDefault(SERIAL_CONSOLES, strings.Join(m.Consoles, " "))
+	setDefault(IMAGE_FSTYPES, strings.Join(m.Images, " "))
+	setDefault(PREFERRED_PROVIDER+"virtual/kernel", m.Kernel)
+	setDefault(PREFERRED_PROVIDER+"virtual/bootloader", m.Bootloader)
+
+	for key, value := range m.Vars() {
+		setDefault(key, value)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package load
+
+import (
+	"testing"
+
+	"skygo/machine"
+	"skygo/runbook"
+)
+
+func TestSelectMachine(t *testing.T) {
+
+	machine.NewMachine("test-board", func(m *machine.Machine) {
+		m.Arch = "arm"
+		m.OS = "linux-gnueabi"
+		m.Tune = []string{"-mcpu=cortex-a7"}
+	})
+
+	tests := []struct {
+		explicit map[string]interface{}
+		want     map[string]string
+	}{
+		{nil, map[string]string{MACHINEARCH: "arm", MACHINEOS: "linux-gnueabi",
+			MACHINEVENDOR: "", TUNE_CCARGS: "-mcpu=cortex-a7"}},
+		// values equal to defaults are configured explicitly too
+		{map[string]interface{}{MACHINEOS: "linux", TUNE_CCARGS: ""},
+			map[string]string{MACHINEARCH: "arm", MACHINEOS: "linux", TUNE_CCARGS: ""}},
+		{map[string]interface{}{MACHINE: "unknown-board"},
+			map[string]string{MACHINEARCH: "", MACHINEOS: "linux", MACHINEVENDOR: ""}},
+	}
+
+	for i, test := range tests {
+		vars := map[string]interface{}{MACHINE: "test-board"}
+		for key, value := range test.explicit {
+			vars[key] = value
+		}
+		kv := &runbook.KV{}
+		kv.Init2("test", vars)
+
+		selectMachine(kv)
+		for key, want := range test.want {
+			if _, ok := kv.Lookup(key); !ok {
+				t.Errorf("%d: %s is not set", i, key)
+			} else if got := kv.GetStr(key); got != want {
+				t.Errorf("%d: %s = %q, want %q", i, key, got, want)
+			}
+		}
+	}
+}
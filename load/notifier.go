@@ -39,7 +39,7 @@ func logfileExit(ctx runbook.Context, stage string) error {
 
 	carton := getCartonFromCtx(ctx)
 	load := getLoadFromCtx(ctx)
-	s := load.getStage(carton.Provider(), stage, ctx.Get("ISNATIVE").(bool))
+	s := load.getStage(carton.Provider(), stage, getVariantFromCtx(ctx))
 	stdout, stderr := s.getIO()
 
 	if stdout == stderr && stdout != nil {
@@ -67,7 +67,7 @@ func logfileEnter(ctx runbook.Context, stage string) error {
 
 	carton := getCartonFromCtx(ctx)
 	load := getLoadFromCtx(ctx)
-	s := load.getStage(carton.Provider(), stage, ctx.Get("ISNATIVE").(bool))
+	s := load.getStage(carton.Provider(), stage, getVariantFromCtx(ctx))
 	s.setIO(file, file)
 
 	setStageToCtx(ctx, stage)
@@ -79,7 +79,7 @@ func stageSetDone(ctx runbook.Context, stage string) error {
 
 	markStagePlayed(ctx.Owner(), stage, ctx.GetStr("T"), true)
 	load := getLoadFromCtx(ctx)
-	load.markStageDone(ctx.Owner(), stage, ctx.Get("ISNATIVE").(bool))
+	load.markStageDone(ctx.Owner(), stage, getVariantFromCtx(ctx))
 	return nil
 }
 
@@ -0,0 +1,107 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package load
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"skygo/runbook"
+)
+
+// qualified reports whether qualifier @q is satisfied by context, refer to
+// runbook.KVOverrider for qualifiers
+func (ctx *_context) qualified(q string) bool {
+
+	kind, value := q, ""
+	if i := strings.Index(q, ":"); i >= 0 {
+		kind, value = q[:i], q[i+1:]
+	}
+
+	isNative := ctx.variant.Host
+	switch kind {
+	case "native":
+		return isNative
+	case "target":
+		return !isNative
+	case "variant":
+		return ctx.variant.Name() == value
+	case "machine":
+		return !isNative && ctx.GetStr(MACHINE) == value
+	case "arch":
+		return ctx.GetStr(TARGETARCH) == value
+	case "feature":
+		for _, f := range strings.Fields(ctx.GetStr(DISTRO_FEATURES)) {
+			if f == value {
+				return true
+			}
+		}
+		return false
+	}
+	panic(fmt.Sprintf("unknown override qualifier %s", q))
+}
+
+// resolveOverrides resolves overrides of global settings and then carton's,
+// the final value is saved in context.
+// variant's value wins over global one, it's overridden by global overrides.
+// carton's value wins over global one even if global one is overridden
+func (ctx *_context) resolveOverrides() {
+
+	global, local := ctx.load.kv.Overrides(), ctx.carton.Overrides()
+
+	keys := map[string]bool{}
+	for _, o := range append(global, local...) {
+		keys[o.Key] = true
+	}
+
+	ctx.overrides = make(map[string][]string)
+	for key := range keys {
+
+		value, _ := ctx.load.kv.Lookup(key)
+		if v, ok := ctx.variant.Vars[key]; ok {
+			value = v
+		}
+		value, applied := runbook.Resolve(global, key, value, ctx.qualified)
+
+		if v := ctx.carton.Get(key); v != nil {
+			value, applied = v, nil
+		}
+		v, won := runbook.Resolve(local, key, value, ctx.qualified)
+		if len(applied)+len(won) == 0 {
+			continue
+		}
+
+		for _, o := range applied {
+			ctx.overrides[key] = append(ctx.overrides[key], "settings: "+o.String())
+		}
+		for _, o := range won {
+			ctx.overrides[key] = append(ctx.overrides[key],
+				ctx.carton.Provider()+": "+o.String())
+		}
+		ctx.kv.Set(key, v)
+	}
+}
+
+// printOverrides shows overrides which take effect
+func (ctx *_context) printOverrides() {
+
+	keys := []string{}
+	for key := range ctx.overrides {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+
+	fmt.Println("\nOverrides:")
+	for _, key := range keys {
+		fmt.Printf("%12s:\t%v\n", key, ctx.kv.Get(key))
+		for _, o := range ctx.overrides[key] {
+			fmt.Printf("%12s \t  ↳ %s\n", "", o)
+		}
+	}
+}
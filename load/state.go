@@ -9,11 +9,13 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"skygo/carton"
 	"skygo/utils/log"
 )
 
+// states of runbooks, one per variant
 type states struct {
-	runbooks [2]sync.Map
+	runbooks sync.Map // variant name -> *sync.Map of runbook name -> *state
 }
 
 type state struct {
@@ -26,38 +28,38 @@ type metaStage struct {
 	stdout, stderr io.WriteCloser
 }
 
-func index(isNative bool) int {
+func (this *states) variant(v *carton.Variant) *sync.Map {
 
-	index := 0
-	if isNative {
-		index = 1
-	}
-	return index
+	m, _ := this.runbooks.LoadOrStore(v.Name(), new(sync.Map))
+	return m.(*sync.Map)
 }
 
-// loadOrStoreRunbook returns the existing state for the runbook @name if present.
-// Otherwise, it stores and returns the given state.
+// loadOrStoreRunbook returns the existing state for the runbook @name of
+// variant @v if present. Otherwise, it stores and returns the given state.
 // The loaded result is true if the value was loaded, false if stored.
-func (this *states) loadOrStoreRunbook(name string, isNative bool) (*state, bool) {
+func (this *states) loadOrStoreRunbook(name string, v *carton.Variant) (*state, bool) {
 
-	s, ok := this.runbooks[index(isNative)].LoadOrStore(name, new(state))
+	s, ok := this.variant(v).LoadOrStore(name, new(state))
 	return s.(*state), ok
 }
 
-// returns true if runbook is loaded in either native or cross type
+// returns true if runbook is loaded in any variant
 func (this *states) isRunbookLoaded(runbook string) bool {
 
-	_, native := this.runbooks[index(true)].Load(runbook)
-	_, cross := this.runbooks[index(false)].Load(runbook)
-	return native || cross
+	loaded := false
+	this.runbooks.Range(func(_, m interface{}) bool {
+		_, loaded = m.(*sync.Map).Load(runbook)
+		return !loaded
+	})
+	return loaded
 }
 
 // check where the stage @name owned by runbook is loaded
-func (this *states) isStageLoaded(runbook, stage string, isNative bool) bool {
+func (this *states) isStageLoaded(runbook, stage string, v *carton.Variant) bool {
 
-	if meta := this.getStage(runbook, stage, isNative); meta != nil {
+	if meta := this.getStage(runbook, stage, v); meta != nil {
 		if atomic.LoadInt32(meta.done) == 1 {
-			log.Trace("Stage %s had been cached into %s's state", stage, runbook)
+			log.Trace("Stage %s had been cached into %s's state", stage, v.Of(runbook))
 			return true
 		}
 	}
@@ -65,17 +67,17 @@ func (this *states) isStageLoaded(runbook, stage string, isNative bool) bool {
 }
 
 // storeStage mark stage in the runbook had been played
-func (this *states) setStageDone(runbook, stage string, isNative bool) {
+func (this *states) setStageDone(runbook, stage string, v *carton.Variant) {
 
-	if meta := this.getStage(runbook, stage, isNative); meta != nil {
+	if meta := this.getStage(runbook, stage, v); meta != nil {
 		atomic.StoreInt32(meta.done, 1)
-		log.Trace("Cache %s's stage %s into state", runbook, stage)
+		log.Trace("Cache %s's stage %s into state", v.Of(runbook), stage)
 	}
 }
 
-func (this *states) getStage(runbook, stage string, isNative bool) *metaStage {
+func (this *states) getStage(runbook, stage string, v *carton.Variant) *metaStage {
 
-	if s, ok := this.runbooks[index(isNative)].Load(runbook); ok {
+	if s, ok := this.variant(v).Load(runbook); ok {
 
 		state := s.(*state)
 		if meta, ok := state.stages.Load(stage); ok {
@@ -5,64 +5,313 @@
 package load
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 
 	"skygo/carton"
+	"skygo/pkg"
 	"skygo/runbook"
 	"skygo/runbook/xsync"
 	"skygo/utils"
+	"skygo/utils/log"
 )
 
 type cartonRequired struct {
-	isNative bool
-	c        carton.Builder
+	variant *carton.Variant
+	c       carton.Builder
 }
 
-func depTree(c carton.Builder, isNative bool) map[string]cartonRequired {
+// depTree returns build dependencies of carton @c of variant @v recursively,
+// keyed by carton name of their variants
+func depTree(c carton.Builder, v *carton.Variant) map[string]cartonRequired {
 
 	tree := map[string]cartonRequired{}
-	walk(c, isNative, tree)
+	walk(c, v, tree)
 	return tree
 }
 
-func walk(c carton.Builder, isNative bool, tree map[string]cartonRequired) {
+func walk(c carton.Builder, v *carton.Variant, tree map[string]cartonRequired) {
 
 	d := c.BuildDepends()
-	for _, v := range d {
-		if c, _, native, err := carton.Find(v); err == nil {
-			if native {
-				isNative = true
+	for _, spec := range d {
+		dep, err := carton.ParseDependency(spec)
+		if err != nil || !packaged(dep) {
+			continue
+		}
+		if c, _, variant, err := v.Find(dep.Carton()); err == nil {
+			name := variant.Of(c.Provider())
+			if _, ok := tree[name]; ok {
+				continue
 			}
-			tree[v] = cartonRequired{isNative: isNative, c: c}
-			walk(c, isNative, tree)
+			tree[name] = cartonRequired{variant: variant, c: c}
+			walk(c, variant, tree)
+		}
+	}
+}
+
+// packaged returns whether packages of dependency @d are ready when it's
+// satisfied, i.e. it waits on stage package or any stage after it
+func packaged(d *carton.Dependency) bool {
+
+	if d.Stage == "" || d.Stage == carton.PACKAGE {
+		return true
+	}
+	c, _, _, err := carton.Find(d.Carton())
+	if err != nil {
+		return false
+	}
+	for s := c.Runbook().Stage(carton.PACKAGE); s != nil; s = s.Next() {
+		if s.Name() == d.Stage {
+			return true
 		}
 	}
+	return false
+}
+
+// sysrootPkgs returns packages of carton @provider which are staged into
+// sysroot. target variant stages runtime closure of -dev, i.e. main, -dev
+// and -staticdev, so shared and static libraries can be linked against. host
+// variant stages main for tools, and -dev for libraries
+func sysrootPkgs(provider string, host bool) []string {
+
+	if host {
+		return []string{provider, provider + "-dev"}
+	}
+	return []string{provider, provider + "-dev", provider + pkg.STATICDEV}
+}
+
+// staging is one package staged into sysroot
+type staging struct {
+	owner, from, sysroot, wd string
 }
 
 // it does not care value of dir
 func prepare_sysroot(ctx runbook.Context) error {
 
 	carton := getCartonFromCtx(ctx)
-	isNative := ctx.Get("ISNATIVE").(bool)
+	variant := getVariantFromCtx(ctx)
 
-	dest := filepath.Join(ctx.GetStr("WORKDIR"), "sysroot")
+	dest := ctx.GetStr("SYSROOT")
+	destNative := ctx.GetStr("SYSROOT_NATIVE")
 
-	g, _ := xsync.WithContext(ctx.Ctx())
-	for _, d := range depTree(carton, isNative) {
+	// sysroot is rebuilt from scratch, so files of dependency removed or
+	// dropped by its new version are not left
+	for _, dir := range []string{dest, destNative} {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	// one owners per sysroot, alternatives are not staged by any dependency
+	owners := map[string]*utils.Owners{
+		dest:       new(utils.Owners),
+		destNative: new(utils.Owners),
+	}
+	alts := map[string][]pkg.Alternative{}
 
-		d := d
+	stagings := []staging{}
+	for _, d := range depTree(carton, variant) {
+		wd := workDir(d.c, d.variant)
+		sysroot := dest
+		if d.variant.Host {
+			sysroot = destNative
+		}
+
+		for _, n := range sysrootPkgs(d.c.Provider(), d.variant.Host) {
+			if p := d.c.Packager().GetPkg(n); p != nil {
+				for _, alt := range p.Alternatives() {
+					owners[sysroot].Reserve(alt.Link)
+					alts[sysroot] = append(alts[sysroot], alt)
+				}
+			}
+			stagings = append(stagings, staging{n, filepath.Join(wd, "packages", n), sysroot, wd})
+		}
+	}
+	return stageSysroot(ctx.Ctx(), stagings, owners, alts)
+}
+
+// stageSysroot stages packages @stagings concurrently, @owners detect file
+// conflicts in each sysroot. alternatives @alts are applied at last
+func stageSysroot(ctx context.Context, stagings []staging, owners map[string]*utils.Owners,
+	alts map[string][]pkg.Alternative) error {
+
+	var m sync.Mutex
+	conflicts := []string{}
+
+	g, _ := xsync.WithContext(ctx)
+	for _, s := range stagings {
+
+		s := s
 		g.Go(func() error {
-			wd := workDir(d.c, d.isNative)
-			sysroot := dest
-			n := d.c.Provider()
-			if d.isNative {
-				sysroot = dest + "-native"
-			} else {
-				n = n + "-dev"
+			if err := owners[s.sysroot].Stage(s.owner, s.from, s.sysroot); err != nil {
+				e, ok := err.(*utils.ConflictError)
+				if !ok {
+					return err
+				}
+				m.Lock()
+				conflicts = append(conflicts, e.Conflicts...)
+				m.Unlock()
 			}
-			from := filepath.Join(wd, "packages", n)
-			return utils.Stage(from, sysroot)
+			// file staged by another owner is left to it
+			owners := owners[s.sysroot]
+			return fixupSysroot(s.from, s.sysroot, s.wd, func(rel string) bool {
+				return owners.Owner(rel) == s.owner
+			})
 		})
 	}
-	return g.Wait()
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return &utils.ConflictError{Conflicts: conflicts}
+	}
+
+	for sysroot, a := range alts {
+		if err := pkg.ApplyAlternatives(sysroot, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// host paths which must not be referred by files in sysroot
+var hostPaths = regexp.MustCompile(`(^|[\s'"=:]|-[IL])(/(?:usr|lib|lib64|include)(?:/[^\s'":]*)?)`)
+
+// prefix variables of *-config scripts
+var configPrefix = regexp.MustCompile(`(?m)^(\s*(?:prefix|exec_prefix|libdir|includedir)=["']?)/`)
+
+// fixupSysroot relocates files staged from @from into @sysroot, @wd is work
+// directory of dependency who ships these files. only files which @staged
+// reports are staged from @from are relocated, e.g. file staged by another
+// dependency in conflict is skipped
+//
+// pkg-config files keep paths relative to sysroot, since PKG_CONFIG_SYSROOT_DIR
+// prepends sysroot when they are used. libtool archives and *-config scripts
+// have absolute paths rewritten into @sysroot. absolute symbol links are
+// converted to relative. files are rewritten into new file then renamed, hard
+// links to dependency's packages are broken, so the dependency is not changed
+//
+// it fails if any file still refers to build directory of dependency or to
+// host paths
+func fixupSysroot(from, sysroot, wd string, staged func(rel string) bool) error {
+
+	image := filepath.Join(wd, "image")
+	leaks := []string{}
+
+	if err := filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, _ := filepath.Rel(from, path)
+		dest := filepath.Join(sysroot, rel)
+		if !staged(rel) {
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return relativeSymlink(sysroot, dest)
+		}
+
+		base := filepath.Base(rel)
+		var fix func([]byte) []byte
+		checkHost := true
+		switch {
+		case strings.HasSuffix(base, ".pc"):
+			checkHost = false // relative to PKG_CONFIG_SYSROOT_DIR
+			fix = func(data []byte) []byte {
+				return bytes.Replace(data, []byte(image), nil, -1)
+			}
+		case strings.HasSuffix(base, ".la"):
+			fix = func(data []byte) []byte {
+				data = bytes.Replace(data, []byte(image), nil, -1)
+				return hostPaths.ReplaceAll(data, []byte("${1}"+sysroot+"${2}"))
+			}
+		case strings.HasSuffix(base, "-config") && isScript(path):
+			fix = func(data []byte) []byte {
+				data = bytes.Replace(data, []byte(image), []byte(sysroot), -1)
+				data = configPrefix.ReplaceAll(data, []byte("${1}"+sysroot+"/"))
+				return hostPaths.ReplaceAll(data, []byte("${1}"+sysroot+"${2}"))
+			}
+		default:
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(dest)
+		if err != nil {
+			return err
+		}
+		data = fix(data)
+
+		if bytes.Contains(data, []byte(wd)) {
+			leaks = append(leaks, fmt.Sprintf("%s refers to %s", dest, wd))
+		}
+		if checkHost {
+			for _, m := range hostPaths.FindAllSubmatch(data, -1) {
+				leaks = append(leaks, fmt.Sprintf("%s refers to host path %s", dest, m[2]))
+			}
+		}
+
+		log.Trace("Relocate %s into %s", rel, sysroot)
+		tmp := dest + ".tmp"
+		if err := ioutil.WriteFile(tmp, data, info.Mode()); err != nil {
+			return err
+		}
+		return os.Rename(tmp, dest)
+	}); err != nil {
+		return err
+	}
+
+	if len(leaks) > 0 {
+		return fmt.Errorf("sysroot %s is polluted:\n\t%s", sysroot,
+			strings.Join(leaks, "\n\t"))
+	}
+	return nil
+}
+
+// relativeSymlink converts absolute symbol link @path to relative one, its
+// target is resolved inside @sysroot
+func relativeSymlink(sysroot, path string) error {
+
+	link, err := os.Readlink(path)
+	if err != nil || !filepath.IsAbs(link) {
+		return err
+	}
+
+	target := filepath.Join(sysroot, link)
+	if strings.HasPrefix(link, sysroot+"/") {
+		target = link
+	}
+	rel, err := filepath.Rel(filepath.Dir(path), target)
+	if err != nil {
+		return err
+	}
+
+	log.Trace("Convert symbol link %s: %s --> %s", path, link, rel)
+	os.Remove(path)
+	return os.Symlink(rel, path)
+}
+
+// isScript returns whether file @path starts with #!
+func isScript(path string) bool {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, 2)
+	n, _ := f.Read(head)
+	return n == 2 && string(head) == "#!"
 }
@@ -0,0 +1,162 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package load
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"skygo/pkg"
+	"skygo/runbook"
+	"skygo/utils"
+)
+
+// packageCtx is context of PACKAGE stage, only keys are supported
+type packageCtx struct {
+	runbook.Context
+	vars map[string]interface{}
+}
+
+func (c *packageCtx) Owner() string                  { return "libfoo" }
+func (c *packageCtx) Get(key string) interface{}     { return c.vars[key] }
+func (c *packageCtx) Output() (io.Writer, io.Writer) { return ioutil.Discard, ioutil.Discard }
+
+func (c *packageCtx) GetStr(key string) string {
+	s, _ := c.vars[key].(string)
+	return s
+}
+
+// buildLib installs and packages library libfoo into work directory @wd
+func buildLib(t *testing.T, wd string) {
+
+	d := filepath.Join(wd, "image")
+	for rel, data := range map[string]string{
+		"usr/bin/foo":                "#!/bin/sh\n",
+		"usr/include/foo.h":          "int foo(void);\n",
+		"usr/lib/libfoo.so.1":        "ELF",
+		"usr/lib/libfoo.a":           "!<arch>\n",
+		"usr/lib/pkgconfig/foo.pc":   "prefix=/usr\nLibs: -lfoo\n",
+		"usr/share/aclocal/foo.m4":   "dnl foo\n",
+		"usr/share/doc/foo/README":   "foo\n",
+		"usr/share/foo/default.conf": "foo=1\n",
+	} {
+		path := filepath.Join(d, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(data), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("libfoo.so.1", filepath.Join(d, "usr/lib/libfoo.so")); err != nil {
+		t.Fatal(err)
+	}
+
+	var p pkg.Packages
+	for _, suffix := range []string{"", "-dev", pkg.DBG, pkg.STATICDEV, pkg.DOC, pkg.LOCALE} {
+		p.NewPkg("libfoo" + suffix)
+	}
+	ctx := &packageCtx{vars: map[string]interface{}{
+		"INHIBIT_PACKAGE_DEBUG_SPLIT": "1",
+		"INHIBIT_PACKAGE_STRIP":       "1",
+		"PKGDATADIR":                  filepath.Join(wd, "pkgdata"),
+		"TARGETSYS":                   "arm-linux",
+	}}
+	if err := p.Package(ctx, d, filepath.Join(wd, "packages"),
+		pkg.Control{Version: "1.0", Source: "libfoo"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStageSysroot(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "sysroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	wd := filepath.Join(tmp, "libfoo")
+	buildLib(t, wd)
+
+	for _, test := range []struct {
+		host    bool
+		staged  []string
+		skipped []string
+	}{
+		{false,
+			[]string{"usr/lib/libfoo.so", "usr/lib/libfoo.so.1", "usr/lib/libfoo.a",
+				"usr/include/foo.h", "usr/lib/pkgconfig/foo.pc", "usr/share/aclocal/foo.m4"},
+			[]string{"usr/share/doc/foo/README"}},
+		{true,
+			[]string{"usr/bin/foo", "usr/lib/libfoo.so", "usr/lib/libfoo.so.1",
+				"usr/include/foo.h", "usr/lib/pkgconfig/foo.pc"},
+			[]string{"usr/lib/libfoo.a", "usr/share/doc/foo/README"}},
+	} {
+		sysroot := filepath.Join(tmp, "sysroot")
+		if test.host {
+			sysroot += "-native"
+		}
+
+		stagings := []staging{}
+		for _, n := range sysrootPkgs("libfoo", test.host) {
+			stagings = append(stagings, staging{n, filepath.Join(wd, "packages", n), sysroot, wd})
+		}
+		owners := map[string]*utils.Owners{sysroot: new(utils.Owners)}
+		if err := stageSysroot(context.Background(), stagings, owners, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		// Stat follows symbol link, so libfoo.so must resolve in sysroot
+		for _, rel := range test.staged {
+			if _, err := os.Stat(filepath.Join(sysroot, rel)); err != nil {
+				t.Errorf("host %v: %s is not staged: %s", test.host, rel, err)
+			}
+		}
+		for _, rel := range test.skipped {
+			if _, err := os.Lstat(filepath.Join(sysroot, rel)); err == nil {
+				t.Errorf("host %v: %s should not be staged", test.host, rel)
+			}
+		}
+	}
+}
+
+func TestFixupSysrootStaged(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "sysroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	wd := filepath.Join(tmp, "libfoo")
+	from := filepath.Join(wd, "packages", "libfoo-dev")
+	sysroot := filepath.Join(tmp, "sysroot")
+	pc := "prefix=" + filepath.Join(wd, "image") + "/usr\n"
+	for _, dir := range []string{from, sysroot} {
+		os.MkdirAll(filepath.Join(dir, "usr/lib/pkgconfig"), 0755)
+		for _, name := range []string{"foo.pc", "bar.pc"} {
+			path := filepath.Join(dir, "usr/lib/pkgconfig", name)
+			if err := ioutil.WriteFile(path, []byte(pc), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// bar.pc is staged by another dependency
+	staged := func(rel string) bool { return filepath.Base(rel) == "foo.pc" }
+	if err := fixupSysroot(from, sysroot, wd, staged); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"foo.pc": "prefix=/usr\n", "bar.pc": pc} {
+		data, _ := ioutil.ReadFile(filepath.Join(sysroot, "usr/lib/pkgconfig", name))
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+}
@@ -31,6 +31,7 @@ func printenv(ctx runbook.Context) error {
 			fmt.Printf("%12s:\t%s\n", k, v)
 		}
 	})
+	ctx.(*_context).printOverrides()
 	return nil
 }
 
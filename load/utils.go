@@ -13,32 +13,47 @@ import (
 	"skygo/utils/log"
 )
 
-// workDir calculates WORKDIR for carton
-// one carton has different WORKDIR for different arch
-func workDir(c carton.Builder, isNative bool) string {
-	dir := getTargetArch(c, isNative)
+// targetSys calculates system triplet arch[-vendor][-os] for carton of
+// variant @v
+func targetSys(c carton.Builder, v *carton.Variant) string {
+	sys := getTargetArch(c, v)
 
-	if vendor := getTargetVendor(c, isNative); vendor != "" {
-		dir = dir + "-" + vendor
+	if vendor := getTargetVendor(c, v); vendor != "" {
+		sys = sys + "-" + vendor
 	}
-	if os := getTargetOS(c, isNative); os != "" {
-		dir = dir + "-" + os
+	if os := getTargetOS(c, v); os != "" {
+		sys = sys + "-" + os
 	}
+	return sys
+}
+
+// workDir calculates WORKDIR for carton
+// one carton has different WORKDIR for different arch and variant
+func workDir(c carton.Builder, v *carton.Variant) string {
+	dir := targetSys(c, v)
 
 	_, ver := c.Resource().Selected()
-	pn := c.Provider()
-	if isNative {
-		pn = pn + "-native"
-	}
+	pn := v.Of(c.Provider())
 	dir = filepath.Join(getVar(BASEWKDIR), dir, pn, ver)
 	dir, _ = filepath.Abs(dir)
 	return dir
 }
 
-func getTargetArch(c carton.Builder, isNative bool) string {
+// variantVar returns value of setting @key of variant, false if variant
+// doesn't have the key, refer to carton.Variant
+func variantVar(key string) (string, bool) {
+
+	if key == "" {
+		return "", false
+	}
+	v, ok := defaultVars[key].(string)
+	return v, ok
+}
+
+func getTargetArch(c carton.Builder, v *carton.Variant) string {
 
-	if isNative {
-		return getVar(NATIVEARCH)
+	if arch, _ := variantVar(v.Arch); arch != "" {
+		return arch
 	}
 
 	arch := c.Get(TARGETARCH)
@@ -50,27 +65,27 @@ func getTargetArch(c carton.Builder, isNative bool) string {
 	return arch.(string)
 }
 
-func getTargetOS(c carton.Builder, isNative bool) string {
+func getTargetOS(c carton.Builder, v *carton.Variant) string {
 
-	if isNative {
-		return getVar(NATIVEOS)
+	if os, ok := variantVar(v.OS); ok {
+		return os
 	}
 
 	return getVar(MACHINEOS)
 }
 
-func getTargetVendor(c carton.Builder, isNative bool) string {
+func getTargetVendor(c carton.Builder, v *carton.Variant) string {
 
-	if isNative {
-		return getVar(NATIVEVENDOR)
+	if vendor, ok := variantVar(v.Vendor); ok {
+		return vendor
 	}
 
 	return getVar(MACHINEVENDOR)
 }
 
 // value of var S
-func tempDir(c carton.Builder, isNative bool) string {
-	wd := workDir(c, isNative)
+func tempDir(c carton.Builder, v *carton.Variant) string {
+	wd := workDir(c, v)
 	return filepath.Join(wd, "temp")
 }
 
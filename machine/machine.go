@@ -0,0 +1,148 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package machine describes boards which cartons are built for
+package machine
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Machine represents one board
+type Machine struct {
+	Desc string // oneline description
+
+	Arch   string // e.g. arm, aarch64, x86_64
+	Vendor string
+	OS     string // default value is linux
+
+	Tune     []string // CPU tuning flags for compiler, e.g. -mcpu=cortex-a7
+	Features []string // machine features, e.g. usbhost, wifi
+
+	Kernel      string // preferred provider of virtual/kernel
+	Bootloader  string // preferred provider of virtual/bootloader
+	KernelImage string // kernel image type, e.g. zImage, Image
+
+	Consoles []string // serial consoles, e.g. 115200;ttyAMA0
+	Images   []string // image formats, e.g. tar.gz ext4
+
+	name string
+	file string // which file describes this machine
+	vars map[string]interface{}
+}
+
+var (
+	machines = make(map[string]*Machine)
+	mu       sync.Mutex
+)
+
+// NewMachine registers machine @name, @m is called to describe it
+// it's expected to be called in init function like carton.NewCarton
+func NewMachine(name string, m func(*Machine)) {
+
+	_, file, _, _ := runtime.Caller(1)
+
+	if name == "" {
+		panic("Machine Err: Illegal Name")
+	}
+
+	mach := &Machine{
+		name: name,
+		file: file,
+		OS:   "linux",
+		vars: make(map[string]interface{}),
+	}
+	if m != nil {
+		m(mach)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := machines[name]; ok {
+		panic(fmt.Sprintf("Machine Err: %s had been added!", name))
+	}
+	machines[name] = mach
+}
+
+// Find finds machine @name
+func Find(name string) (*Machine, error) {
+
+	mu.Lock()
+	defer mu.Unlock()
+	if m, ok := machines[name]; ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("machine %s is not found", name)
+}
+
+// Machines returns all machines sorted by name
+func Machines() []*Machine {
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	all := make([]*Machine, 0, len(machines))
+	for _, m := range machines {
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+	return all
+}
+
+// Name returns name of machine
+func (m *Machine) Name() string { return m.name }
+
+// From returns which file describes machine
+func (m *Machine) From() string { return m.file }
+
+// Set sets extra global setting @key when machine is selected
+func (m *Machine) Set(key string, value interface{}) {
+	m.vars[key] = value
+}
+
+// Vars returns extra global settings
+func (m *Machine) Vars() map[string]interface{} {
+	return m.vars
+}
+
+func (m *Machine) String() string {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s", m.name)
+	if m.Desc != "" {
+		fmt.Fprintf(&b, ": %s", m.Desc)
+	}
+	fmt.Fprintf(&b, "\n  arch: %s", m.Arch)
+	if m.Vendor != "" {
+		fmt.Fprintf(&b, "-%s", m.Vendor)
+	}
+	if m.OS != "" {
+		fmt.Fprintf(&b, "-%s", m.OS)
+	}
+
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"tune", strings.Join(m.Tune, " ")},
+		{"features", strings.Join(m.Features, " ")},
+		{"kernel", m.Kernel},
+		{"kernel image", m.KernelImage},
+		{"bootloader", m.Bootloader},
+		{"consoles", strings.Join(m.Consoles, " ")},
+		{"images", strings.Join(m.Images, " ")},
+	}
+	for _, f := range fields {
+		if f.value != "" {
+			fmt.Fprintf(&b, "\n  %s: %s", f.name, f.value)
+		}
+	}
+	fmt.Fprintf(&b, "\n  from: %s", m.file)
+	return b.String()
+}
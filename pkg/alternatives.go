@@ -0,0 +1,146 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"skygo/utils"
+	"skygo/utils/log"
+)
+
+// Alternative is one candidate of link shared by several packages, e.g.
+// /bin/ls is provided by both busybox and coreutils. the candidate with
+// highest priority wins, and link points to its target
+type Alternative struct {
+	Name     string `json:"name"`
+	Link     string `json:"link"`   // absolute path of shared link
+	Target   string `json:"target"` // absolute path link points to
+	Priority int    `json:"priority"`
+}
+
+// Alternative declares package provides alternative @name with @link points
+// to @target by @priority. if package ships regular file @link, it's renamed
+// to @target
+func (p *Pkg) Alternative(name, link, target string, priority int) *Pkg {
+
+	if !filepath.IsAbs(link) || !filepath.IsAbs(target) {
+		panic(fmt.Sprintf("package %s: link and target of alternative %s must be absolute path",
+			p.name, name))
+	}
+	if link == target {
+		panic(fmt.Sprintf("package %s: alternative %s points to itself", p.name, name))
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	for i, alt := range p.alternatives {
+		if alt.Name == name {
+			p.alternatives[i] = Alternative{name, link, target, priority}
+			return p
+		}
+	}
+	p.alternatives = append(p.alternatives, Alternative{name, link, target, priority})
+	return p
+}
+
+// Alternatives returns all alternatives of package
+func (p *Pkg) Alternatives() []Alternative {
+	return p.alternatives
+}
+
+// prepareAlternatives makes alternative links shipped in package directory
+// @dir managed by alternatives. symbol link is removed, regular file is
+// renamed to target
+func (p *Pkg) prepareAlternatives(dir string) error {
+
+	for _, alt := range p.alternatives {
+		link := filepath.Join(dir, alt.Link)
+		info, err := os.Lstat(link)
+		if err != nil {
+			continue
+		}
+
+		target := filepath.Join(dir, alt.Target)
+		if info.Mode().IsRegular() && !utils.IsExist(target) {
+			log.Trace("Rename %s to %s for alternative %s", alt.Link, alt.Target, alt.Name)
+			if err := os.Rename(link, target); err != nil {
+				return err
+			}
+			continue
+		}
+		os.Remove(link)
+	}
+	return nil
+}
+
+// alternativeScripts returns maintainer scripts to register alternatives of
+// package by update-alternatives on target
+func (p *Pkg) alternativeScripts() (postinst, prerm string) {
+
+	for _, alt := range p.alternatives {
+		postinst += fmt.Sprintf("update-alternatives --install %s %s %s %d\n",
+			alt.Link, alt.Name, alt.Target, alt.Priority)
+		prerm += fmt.Sprintf("update-alternatives --remove %s %s\n", alt.Name, alt.Target)
+	}
+	return
+}
+
+// SelectAlternatives selects the candidate with highest priority for each
+// link of @alts. candidates with equal priority are ordered by target
+func SelectAlternatives(alts []Alternative) []Alternative {
+
+	best := map[string]Alternative{}
+	for _, alt := range alts {
+		if cur, ok := best[alt.Link]; ok {
+			if cur.Priority > alt.Priority ||
+				(cur.Priority == alt.Priority && cur.Target < alt.Target) {
+				continue
+			}
+		}
+		best[alt.Link] = alt
+	}
+
+	selected := []Alternative{}
+	for _, alt := range best {
+		selected = append(selected, alt)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Link < selected[j].Link
+	})
+	return selected
+}
+
+// ApplyAlternatives creates link of selected alternatives @alts under @root
+// links are relative, then they are valid in both sysroot and target
+func ApplyAlternatives(root string, alts []Alternative) error {
+
+	for _, alt := range SelectAlternatives(alts) {
+		link := filepath.Join(root, alt.Link)
+		target, err := filepath.Rel(filepath.Dir(alt.Link), alt.Target)
+		if err != nil {
+			return err
+		}
+
+		if info, err := os.Lstat(link); err == nil {
+			if info.Mode()&os.ModeSymlink == 0 {
+				return fmt.Errorf("alternative %s: %s exists and is not symbol link",
+					alt.Name, alt.Link)
+			}
+			os.Remove(link)
+		}
+
+		log.Trace("Alternative %s: %s --> %s", alt.Name, alt.Link, alt.Target)
+		os.MkdirAll(filepath.Dir(link), 0755)
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
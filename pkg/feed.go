@@ -0,0 +1,107 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"skygo/utils/log"
+)
+
+// Index generates feed index Packages and Packages.gz under directory @dir
+// Each package archive under @dir contributes one stanza that consists of its
+// control file plus Filename, Size and SHA256sum, so that opkg or apt on
+// target devices can consume @dir served by any static HTTP server
+func Index(dir string) error {
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.ipk"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	var buf bytes.Buffer
+	for _, file := range files {
+
+		control, err := ipkControl(file)
+		if err != nil {
+			return err
+		}
+
+		size, sum, err := sizeSha256(file)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(bytes.TrimRight(control, "\n"))
+		fmt.Fprintf(&buf, "\nFilename: %s\n", filepath.Base(file))
+		fmt.Fprintf(&buf, "Size: %d\n", size)
+		fmt.Fprintf(&buf, "SHA256sum: %s\n\n", sum)
+	}
+
+	index := filepath.Join(dir, "Packages")
+	if err := ioutil.WriteFile(index, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	w, err := os.Create(index + ".gz")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	gw := gzip.NewWriter(w)
+	if _, err := gw.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	log.Info("Feed index %s is generated with %d packages", index, len(files))
+	return nil
+}
+
+// Feeds returns directories of package feed under @root. one arch one feed
+func Feeds(root string) ([]string, error) {
+
+	infos, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	feeds := []string{}
+	for _, info := range infos {
+		if info.IsDir() {
+			feeds = append(feeds, info.Name())
+		}
+	}
+	return feeds, nil
+}
+
+func sizeSha256(fpath string) (int64, string, error) {
+
+	file, err := os.Open(fpath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
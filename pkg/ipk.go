@@ -0,0 +1,320 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ipk is an ar archive which holds three members by order:
+//   debian-binary:   format version
+//   control.tar.gz:  control file and maintainer scripts
+//   data.tar.gz:     files to be installed
+// refer: https://git.yoctoproject.org/opkg/about/
+
+const arMagic = "!<arch>\n"
+
+// ErrNoControl is returned if control file is not found in package
+var ErrNoControl = errors.New("control file is not found")
+
+// mtime returns modification time of archive members, it's SOURCE_DATE_EPOCH
+// if set, otherwise unix epoch, so package is reproducible. true is returned
+// if SOURCE_DATE_EPOCH is set, then files newer than it are clamped to it
+func mtime() (time.Time, bool) {
+
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if sec, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			return time.Unix(sec, 0), true
+		}
+	}
+	return time.Unix(0, 0), false
+}
+
+// packIpk archives directory @dir into ipk file @to
+// @control holds control file and maintainer scripts, key is file name
+// broken ipk file is removed if any write fails, e.g. disk is full
+func packIpk(dir, to string, control map[string][]byte) (err error) {
+
+	data, err := tgzDir(dir)
+	if err != nil {
+		return err
+	}
+
+	ctrl, err := tgzFiles(control)
+	if err != nil {
+		return err
+	}
+
+	os.MkdirAll(filepath.Dir(to), 0755)
+	w, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := w.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			os.Remove(to)
+		}
+	}()
+
+	if _, err := io.WriteString(w, arMagic); err != nil {
+		return err
+	}
+	for _, m := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", ctrl},
+		{"data.tar.gz", data},
+	} {
+		if err := arWrite(w, m.name, m.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// arWrite writes one member of ar archive
+func arWrite(w io.Writer, name string, data []byte) error {
+
+	t, _ := mtime()
+	hdr := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n",
+		name+"/", t.Unix(), 0, 0, 0100644, len(data))
+	if _, err := io.WriteString(w, hdr); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	// member data is aligned by 2 bytes
+	if len(data)%2 != 0 {
+		_, err := w.Write([]byte{'\n'})
+		return err
+	}
+	return nil
+}
+
+// arRead finds member @name in ar archive @r and return its data
+func arRead(r io.Reader, name string) ([]byte, error) {
+
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != arMagic {
+		return nil, fmt.Errorf("not ar archive")
+	}
+
+	hdr := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("%s is not found in ar archive", name)
+			}
+			return nil, err
+		}
+
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ar header is broken")
+		}
+
+		member := strings.TrimSuffix(strings.TrimSpace(string(hdr[0:16])), "/")
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		if size%2 != 0 {
+			io.CopyN(ioutil.Discard, r, 1)
+		}
+
+		if member == name {
+			return data, nil
+		}
+	}
+}
+
+// tgzFiles creates gzip tarball in memory. key of @files is file name
+func tgzFiles(files map[string][]byte) ([]byte, error) {
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names) // keep archive reproducible
+
+	t, _ := mtime()
+	for _, name := range names {
+		data := files[name]
+		mode := int64(0644)
+		if name != "control" && name != "conffiles" {
+			mode = 0755 // maintainer scripts
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    "./" + name,
+			Mode:    mode,
+			Size:    int64(len(data)),
+			ModTime: t,
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tgzDir creates gzip tarball of directory @dir in memory
+func tgzDir(dir string) ([]byte, error) {
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	// hard links are archived once, subsequent ones refer to the first one
+	inodes := map[uint64]string{}
+	epoch, clamp := mtime()
+
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		name := "./" + filepath.ToSlash(rel)
+		if rel == "." {
+			name = "./"
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "root", "root"
+		if clamp && hdr.ModTime.After(epoch) {
+			hdr.ModTime = epoch
+		}
+		if info.IsDir() && name != "./" {
+			hdr.Name += "/"
+		}
+
+		if info.Mode().IsRegular() {
+			if ino, nlink := inode(info); nlink > 1 {
+				if first, ok := inodes[ino]; ok {
+					hdr.Typeflag = tar.TypeLink
+					hdr.Linkname = first
+					hdr.Size = 0
+				} else {
+					inodes[ino] = name
+				}
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			// close file at once, package may have lots of files
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(tw, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ipkControl extracts control file from ipk file @fpath
+func ipkControl(fpath string) ([]byte, error) {
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := arRead(f, "control.tar.gz")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fpath, err)
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fpath, err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", fpath, err)
+		}
+		if strings.TrimPrefix(hdr.Name, "./") == "control" {
+			return ioutil.ReadAll(tr)
+		}
+	}
+	return nil, fmt.Errorf("%s: %s", fpath, ErrNoControl)
+}
+
+// inode returns inode number and the number of hard links of file
+func inode(info os.FileInfo) (uint64, uint64) {
+
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino), uint64(st.Nlink)
+	}
+	return 0, 1
+}
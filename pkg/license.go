@@ -0,0 +1,209 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"skygo/utils"
+)
+
+// LicenseError reports packages whose licenses are incompatible
+type LicenseError struct {
+	Offenders []string
+}
+
+func (e *LicenseError) Error() string {
+	return fmt.Sprintf("incompatible licenses are detected:\n\t%s",
+		strings.Join(e.Offenders, "\n\t"))
+}
+
+// license is node of parsed license expression, leaf has name
+type license struct {
+	name  string
+	and   bool // all of terms are required, otherwise one of them
+	terms []*license
+}
+
+// tokenize splits license expression @expr into names, operators and
+// parentheses. SPDX operators AND, OR are replaced by & and |, WITH and its
+// exception are dropped
+func tokenize(expr string) []string {
+
+	for _, c := range []string{"(", ")", "&", "|"} {
+		expr = strings.Replace(expr, c, " "+c+" ", -1)
+	}
+
+	tokens := []string{}
+	fields := strings.Fields(expr)
+	for i := 0; i < len(fields); i++ {
+		switch f := fields[i]; f {
+		case "AND":
+			tokens = append(tokens, "&")
+		case "OR":
+			tokens = append(tokens, "|")
+		case "WITH":
+			i++
+		default:
+			tokens = append(tokens, f)
+		}
+	}
+	return tokens
+}
+
+// parseLicense parses license expression @expr, e.g.
+//
+//	GPL-2.0-only | MIT
+//	(LGPL-2.1-or-later & BSD-3-Clause) | MIT
+//	Apache-2.0 WITH LLVM-exception OR MIT
+//
+// & takes precedence over |
+func parseLicense(expr string) (*license, error) {
+
+	tokens := tokenize(expr)
+	pos := 0
+
+	var parseOr func() (*license, error)
+	parseTerm := func() (*license, error) {
+		if pos >= len(tokens) {
+			return nil, fmt.Errorf("license %q: unexpected end", expr)
+		}
+		switch t := tokens[pos]; t {
+		case "(":
+			pos++
+			l, err := parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if pos >= len(tokens) || tokens[pos] != ")" {
+				return nil, fmt.Errorf("license %q: missing )", expr)
+			}
+			pos++
+			return l, nil
+		case ")", "&", "|":
+			return nil, fmt.Errorf("license %q: unexpected %s", expr, t)
+		default:
+			pos++
+			return &license{name: t}, nil
+		}
+	}
+	parse := func(op string, and bool, next func() (*license, error)) (*license, error) {
+		l, err := next()
+		if err != nil {
+			return nil, err
+		}
+		node := &license{and: and, terms: []*license{l}}
+		for pos < len(tokens) && tokens[pos] == op {
+			pos++
+			if l, err = next(); err != nil {
+				return nil, err
+			}
+			node.terms = append(node.terms, l)
+		}
+		if len(node.terms) == 1 {
+			return node.terms[0], nil
+		}
+		return node, nil
+	}
+	parseAnd := func() (*license, error) { return parse("&", true, parseTerm) }
+	parseOr = func() (*license, error) { return parse("|", false, parseAnd) }
+
+	l, err := parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if pos < len(tokens) {
+		return nil, fmt.Errorf("license %q: unexpected %s", expr, tokens[pos])
+	}
+	return l, nil
+}
+
+// allowed returns whether license can be satisfied without licenses matched
+// by glob @incompatible, e.g. GPL-3.0*. if not, it returns offending licenses
+func (l *license) allowed(incompatible []string) (bool, []string) {
+
+	if l.name != "" {
+		for _, glob := range incompatible {
+			if matched, _ := filepath.Match(glob, l.name); matched {
+				return false, []string{l.name}
+			}
+		}
+		return true, nil
+	}
+
+	offenders := []string{}
+	for _, t := range l.terms {
+		ok, bad := t.allowed(incompatible)
+		if ok && !l.and {
+			return true, nil
+		}
+		offenders = append(offenders, bad...)
+	}
+	return len(offenders) == 0, offenders
+}
+
+// CheckLicenses checks licenses of packages @records against glob
+// @incompatible, packages which can't be used are reported by LicenseError.
+// package without license is not checked
+func CheckLicenses(records []*Record, incompatible []string) error {
+
+	if len(incompatible) == 0 {
+		return nil
+	}
+
+	offenders := []string{}
+	for _, r := range records {
+		if r.License == "" {
+			continue
+		}
+		l, err := parseLicense(r.License)
+		if err != nil {
+			return fmt.Errorf("package %s: %s", r.Package, err)
+		}
+		if ok, bad := l.allowed(incompatible); !ok {
+			offenders = append(offenders, fmt.Sprintf("%s (carton %s): %s is incompatible",
+				r.Package, r.Carton, strings.Join(bad, ", ")))
+		}
+	}
+	if len(offenders) > 0 {
+		sort.Strings(offenders)
+		return &LicenseError{Offenders: offenders}
+	}
+	return nil
+}
+
+// CollectLicenses copies license texts of packages @records into @dir, one
+// sub directory per carton, and writes license of each package into
+// @dir/licenses.txt: package carton license
+func CollectLicenses(dir string, records []*Record) error {
+
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+
+	var b strings.Builder
+	copied := map[string]bool{}
+	for _, r := range records {
+
+		lic := r.License
+		if lic == "" {
+			lic = "unknown"
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", r.Package, r.Carton, lic)
+
+		if r.LicenseDir == "" || copied[r.Carton] {
+			continue
+		}
+		copied[r.Carton] = true
+		if err := utils.CopyTree(r.LicenseDir, filepath.Join(dir, r.Carton)); err != nil {
+			return fmt.Errorf("license texts of carton %s: %s", r.Carton, err)
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "licenses.txt"), []byte(b.String()), 0644)
+}
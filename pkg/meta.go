@@ -0,0 +1,356 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"skygo/utils"
+)
+
+// maintainer scripts
+const (
+	PREINST  = "preinst"
+	POSTINST = "postinst"
+	PRERM    = "prerm"
+	POSTRM   = "postrm"
+)
+
+// Pkg represents one individual package
+// It inherits StageBox to select which files are shipped, and holds metadata
+// written into control file of package
+type Pkg struct {
+	*utils.StageBox
+
+	name string // individual package name
+
+	m sync.Mutex
+
+	depends    []string
+	recommends []string
+	conflicts  []string
+	replaces   []string
+	provides   []string
+	conffiles  []string
+
+	revision string
+	epoch    string
+	scripts  map[string]string
+
+	alternatives []Alternative
+
+	isSplit    bool
+	allowEmpty bool
+}
+
+func newPkg(name string) *Pkg {
+	return &Pkg{
+		StageBox: new(utils.StageBox),
+		name:     name,
+		scripts:  make(map[string]string),
+	}
+}
+
+// Name returns package name
+func (p *Pkg) Name() string {
+	return p.name
+}
+
+// clone returns copy of package named @name, package names of relationships
+// are converted by @rename
+func (p *Pkg) clone(name string, rename func(string) string) *Pkg {
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	relations := func(list []string) []string {
+		var rels []string
+		for _, r := range list {
+			n := relationName(r)
+			rels = append(rels, rename(n)+r[len(n):])
+		}
+		return rels
+	}
+
+	c := &Pkg{
+		StageBox:   p.StageBox.Clone(),
+		name:       name,
+		depends:    relations(p.depends),
+		recommends: relations(p.recommends),
+		conflicts:  relations(p.conflicts),
+		replaces:   relations(p.replaces),
+		provides:   relations(p.provides),
+		conffiles:  append([]string(nil), p.conffiles...),
+		revision:   p.revision,
+		epoch:      p.epoch,
+		scripts:    make(map[string]string, len(p.scripts)),
+		isSplit:    p.isSplit,
+		allowEmpty: p.allowEmpty,
+
+		alternatives: append([]Alternative(nil), p.alternatives...),
+	}
+	for kind, script := range p.scripts {
+		c.scripts[kind] = script
+	}
+	return c
+}
+
+// appendRelation appends relationship to @list
+// relationship format: name or name (op version), e.g. "openssl (>= 1.1)"
+// multiple relationships can be given in one string with delimiter comma
+func (p *Pkg) appendRelation(list *[]string, rels []string) []string {
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	for _, rel := range rels {
+		for _, r := range strings.Split(rel, ",") {
+			if r = strings.TrimSpace(r); r == "" {
+				continue
+			}
+			found := false
+			for i, v := range *list {
+				if relationName(v) == relationName(r) {
+					// relationship with version constraint wins
+					if !strings.Contains(v, "(") {
+						(*list)[i] = r
+					}
+					found = true
+					break
+				}
+			}
+			if !found {
+				*list = append(*list, r)
+			}
+		}
+	}
+	return *list
+}
+
+// relationName returns package name of relationship @rel
+func relationName(rel string) string {
+	if i := strings.IndexAny(rel, " ("); i >= 0 {
+		return rel[:i]
+	}
+	return rel
+}
+
+// Depends adds runtime dependencies of package
+// dep format: name or name (op version), delimiter is comma
+// Always return the same kind of relationship
+func (p *Pkg) Depends(dep ...string) []string {
+	return p.appendRelation(&p.depends, dep)
+}
+
+// Recommends adds packages that are installed together in a usual setup
+// Always return the same kind of relationship
+func (p *Pkg) Recommends(rec ...string) []string {
+	return p.appendRelation(&p.recommends, rec)
+}
+
+// Conflicts adds packages that can't be installed together with this one
+// Always return the same kind of relationship
+func (p *Pkg) Conflicts(conflict ...string) []string {
+	return p.appendRelation(&p.conflicts, conflict)
+}
+
+// Replaces adds packages whose files are overwritten by this one
+// Always return the same kind of relationship
+func (p *Pkg) Replaces(replace ...string) []string {
+	return p.appendRelation(&p.replaces, replace)
+}
+
+// Provides adds virtual package names provided by this one
+// Always return the same kind of relationship
+func (p *Pkg) Provides(provide ...string) []string {
+	return p.appendRelation(&p.provides, provide)
+}
+
+// Conffiles adds configuration files which are preserved on upgrade
+// path must be absolute path on target, e.g. /etc/foo.conf
+// Always return all configuration files
+func (p *Pkg) Conffiles(path ...string) []string {
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	for _, v := range path {
+		if !filepath.IsAbs(v) {
+			panic(fmt.Sprintf("conffile %s of package %s must be ABS path", v, p.name))
+		}
+		p.conffiles = append(p.conffiles, v)
+	}
+	return p.conffiles
+}
+
+// SetRevision sets package revision, which overrides revision of carton
+func (p *Pkg) SetRevision(revision string) *Pkg {
+	p.revision = revision
+	return p
+}
+
+// SetEpoch sets package epoch, which overrides epoch of carton
+func (p *Pkg) SetEpoch(epoch string) *Pkg {
+	p.epoch = epoch
+	return p
+}
+
+// Script assigns maintainer script @script for @kind
+// kind is one of PREINST, POSTINST, PRERM and POSTRM
+// script is shell script string, it's run by /bin/sh on target
+func (p *Pkg) Script(kind, script string) *Pkg {
+
+	switch kind {
+	case PREINST, POSTINST, PRERM, POSTRM:
+	default:
+		panic(fmt.Sprintf("package %s has unknown maintainer script %s", p.name, kind))
+	}
+
+	p.m.Lock()
+	p.scripts[kind] = script
+	p.m.Unlock()
+	return p
+}
+
+// AllowEmpty marks package is allowed to be empty, then QA does not report it
+func (p *Pkg) AllowEmpty() *Pkg {
+	p.allowEmpty = true
+	return p
+}
+
+// Scripts returns maintainer scripts. key is kind of script
+func (p *Pkg) Scripts() map[string]string {
+	return p.scripts
+}
+
+// Version returns full version [epoch:]version[-revision] of package
+// revision and epoch fall back to @ctrl if they are not set for package
+func (p *Pkg) Version(ctrl Control) string {
+
+	ver := ctrl.Version
+	if ver == "" {
+		ver = "0"
+	}
+
+	epoch, rev := ctrl.Epoch, ctrl.Revision
+	if p.epoch != "" {
+		epoch = p.epoch
+	}
+	if p.revision != "" {
+		rev = p.revision
+	}
+
+	if rev != "" {
+		ver = ver + "-" + rev
+	}
+	if epoch != "" && epoch != "0" {
+		ver = epoch + ":" + ver
+	}
+	return ver
+}
+
+// control generates control file of package
+func (p *Pkg) control(ctrl Control) []byte {
+
+	var b strings.Builder
+
+	writeField(&b, "Package", p.name)
+	writeField(&b, "Version", p.Version(ctrl))
+	writeField(&b, "Architecture", ctrl.Architecture)
+	if ctrl.Maintainer != "" {
+		writeField(&b, "Maintainer", ctrl.Maintainer)
+	}
+	if ctrl.Source != "" {
+		writeField(&b, "Source", ctrl.Source)
+	}
+	if ctrl.Homepage != "" {
+		writeField(&b, "Homepage", ctrl.Homepage)
+	}
+	if ctrl.License != "" {
+		writeField(&b, "License", ctrl.License)
+	}
+
+	for _, rel := range []struct {
+		field string
+		list  []string
+	}{
+		{"Depends", p.depends},
+		{"Recommends", p.recommends},
+		{"Conflicts", p.conflicts},
+		{"Replaces", p.replaces},
+		{"Provides", p.provides},
+	} {
+		if len(rel.list) > 0 {
+			writeField(&b, rel.field, strings.Join(rel.list, ", "))
+		}
+	}
+
+	desc := ctrl.Description
+	if desc == "" {
+		desc = p.name
+	}
+	writeField(&b, "Description", desc)
+	return []byte(b.String())
+}
+
+// writeField writes field @name of control file, continuation lines of
+// multi-line @value are folded with a leading space and empty ones are
+// written as " ." as required by Debian control format
+func writeField(b *strings.Builder, name, value string) {
+
+	lines := strings.Split(strings.TrimRight(value, "\n"), "\n")
+	fmt.Fprintf(b, "%s: %s\n", name, strings.TrimSpace(lines[0]))
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			line = "."
+		}
+		fmt.Fprintf(b, " %s\n", line)
+	}
+}
+
+// controlFiles returns all files archived into control.tar.gz
+func (p *Pkg) controlFiles(ctrl Control) map[string][]byte {
+
+	files := map[string][]byte{"control": p.control(ctrl)}
+
+	if len(p.conffiles) > 0 {
+		files["conffiles"] = []byte(strings.Join(p.conffiles, "\n") + "\n")
+	}
+
+	scripts := map[string]string{}
+	for kind, script := range p.scripts {
+		scripts[kind] = script
+	}
+	// register alternatives before script of carton, and remove them at last
+	if postinst, prerm := p.alternativeScripts(); postinst != "" {
+		shebang, body := splitShebang(scripts[POSTINST])
+		scripts[POSTINST] = shebang + postinst + body
+		scripts[PRERM] += prerm
+	}
+
+	for kind, script := range scripts {
+		if !strings.HasPrefix(script, "#!") {
+			script = "#!/bin/sh\n" + script
+		}
+		files[kind] = []byte(script)
+	}
+	return files
+}
+
+// splitShebang splits @script into interpreter line and body
+func splitShebang(script string) (string, string) {
+
+	if !strings.HasPrefix(script, "#!") {
+		return "#!/bin/sh\n", script
+	}
+	if i := strings.IndexByte(script, '\n'); i >= 0 {
+		return script[:i+1], script[i+1:]
+	}
+	return script + "\n", ""
+}
@@ -5,94 +5,372 @@
 package pkg
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"skygo/fetch"
+	"skygo/runbook"
 	"skygo/utils"
 	"skygo/utils/log"
 )
 
+// default patterns of main package. refer to utils.StageBox for pattern syntax
 var pn = [...]string{
 	"usr/bin",
+	"!usr/bin/*-config",
 	"usr/sbin",
 	"bin",
 	"sbin",
-	"usr/lib",
-	"lib",
+	"usr/libexec",
+	"usr/lib/*.so.*",
+	"usr/lib/*/", // e.g. plugins of carton
+	"!usr/lib/pkgconfig",
+	"!usr/lib/cmake",
+	"lib/*.so.*",
+	"lib/*/", // e.g. lib/modules, lib/firmware
 	"etc",
+	"var",
+	"usr/share",
+	"!usr/share/pkgconfig",
+	"!usr/share/aclocal",
+	"!usr/share/cmake",
 }
 
+// default patterns of package -dev
 var pn_dev = [...]string{
 	"usr/include",
-	"usr/lib",
-	"lib",
-}
-
-type pkg struct {
-	box  *utils.StageBox
-	name string // individual package name
+	"usr/bin/*-config",
+	"usr/lib/*.so",
+	"usr/lib/*.la",
+	"usr/lib/*.o",
+	"usr/lib/pkgconfig",
+	"usr/lib/cmake",
+	"lib/*.so",
+	"lib/*.la",
+	"usr/share/pkgconfig",
+	"usr/share/aclocal",
+	"usr/share/cmake",
 }
 
 // Package is interface to handle package
 type Packager interface {
 	// get individual package by name
-	GetPkg(name string) *utils.StageBox
+	GetPkg(name string) *Pkg
 
 	// new individual package
-	NewPkg(name string) *utils.StageBox
+	NewPkg(name string) *Pkg
+
+	// new split package or add patterns to it, refer to Packages.Split
+	Split(name string, patterns ...string) *Pkg
+}
+
+// Control holds control fields shared by all packages of one carton
+type Control struct {
+	Version      string
+	Revision     string // package revision, can be overridden by Pkg.SetRevision
+	Epoch        string // package epoch, can be overridden by Pkg.SetEpoch
+	Architecture string
+	Maintainer   string
+	Description  string
+	Homepage     string
+	License      string
+	LicenseDir   string // where verified license texts are
+	Source       string // which carton produces the package
+
+	Sources []fetch.Source // where source code of carton comes from
 }
 
 // Packges implements interface Packager
 type Packages struct {
 	owner string
-	pkgs  map[string]pkg
+	pkgs  map[string]*Pkg
+	order []string // packages by order of creation
+
+	splits   []string // split packages by order of creation
+	dynamics []dynamicSplit
+
+	keep *utils.StageBox // files not stripped
+
+	rename func(string) string // package name of variant, refer to Clone
 }
 
-// NewPkg create new stageBox for package @name and add into Packages
-func (p *Packages) NewPkg(name string) *utils.StageBox {
+// NewPkg create new package @name and add into Packages
+func (p *Packages) NewPkg(name string) *Pkg {
 	if p.pkgs == nil {
 		p.owner = name
-		p.pkgs = make(map[string]pkg)
+		p.pkgs = make(map[string]*Pkg)
 	}
 
-	box := new(utils.StageBox)
-	pkg := pkg{box: box, name: name}
+	pkg := newPkg(p.nameOf(name))
 
 	devpkg := p.owner + "-dev"
 
 	switch name {
 	case p.owner:
 		for _, v := range pn {
-			box.Push(v)
+			pkg.Push(v)
 		}
 	case devpkg:
 		for _, v := range pn_dev {
-			box.Push(v)
+			pkg.Push(v)
 		}
-		pkg.name = devpkg
+		pkg.Depends(p.nameOf(p.owner))
+		pkg.AllowEmpty()
 	}
 
-	p.pkgs[pkg.name] = pkg
-	return box
+	p.pkgs[name] = pkg
+	p.order = append(p.order, name)
+
+	for _, split := range defaultSplits {
+		if name == p.owner+split.suffix {
+			p.Split(name, split.patterns...).AllowEmpty()
+			if split.suffix == STATICDEV {
+				pkg.Depends(p.nameOf(devpkg))
+			}
+		}
+	}
+	return pkg
 }
 
 // GetPkg get package @name from Packages
-func (p *Packages) GetPkg(name string) *utils.StageBox {
-	return p.pkgs[name].box
+// if not found, return nil
+func (p *Packages) GetPkg(name string) *Pkg {
+	return p.pkgs[name]
+}
+
+// Clone returns copy of Packages for one variant of carton, packaging only
+// changes the copy, so variants can be packaged at the same time. package
+// names of the copy are converted by @rename, e.g. zlib-dev to lib32-zlib-dev,
+// so are relationships among packages of the copy. packages are still got and
+// staged by original names
+func (p *Packages) Clone(rename func(string) string) *Packages {
+
+	c := &Packages{
+		owner:    p.owner,
+		pkgs:     make(map[string]*Pkg, len(p.pkgs)),
+		order:    append([]string(nil), p.order...),
+		splits:   append([]string(nil), p.splits...),
+		dynamics: append([]dynamicSplit(nil), p.dynamics...),
+		rename:   rename,
+	}
+	if p.keep != nil {
+		c.keep = p.keep.Clone()
+	}
+
+	relation := func(name string) string {
+		if _, ok := p.pkgs[name]; ok {
+			return c.nameOf(name)
+		}
+		return name
+	}
+	for name, pkg := range p.pkgs {
+		c.pkgs[name] = pkg.clone(c.nameOf(name), relation)
+	}
+	return c
 }
 
-// Package pack files from @from to @to
-func (p *Packages) Package(from, to string) error {
+// nameOf returns package name of package @name, refer to Clone
+func (p *Packages) nameOf(name string) string {
 
-	for _, pkg := range p.pkgs {
-		dest := filepath.Join(to, pkg.name)
-		log.Info("Start staging files from %s to %s\n", from, dest)
-		os.RemoveAll(dest)
-		if err := pkg.box.Stage(from, dest); err != nil {
+	if p.rename == nil {
+		return name
+	}
+	return p.rename(name)
+}
+
+// Package stages files from @from to @to, one sub directory per package.
+// Each file is shipped in the first package whose patterns match it. split
+// packages are evaluated firstly by order of creation, then other packages
+// by order of creation. Then debug information of ELF files is split into
+// package -dbg unless INHIBIT_PACKAGE_DEBUG_SPLIT is set, and ELF files are
+// stripped unless INHIBIT_PACKAGE_STRIP is set.
+// Finally runtime dependencies on shared libraries are detected and package
+// data, including shipped files, is recorded under PKGDATADIR/TARGETSYS for
+// other cartons and queries, replacing all records of carton ctrl.Source
+func (p *Packages) Package(ctx runbook.Context, from, to string, ctrl Control) error {
+
+	p.expandDynamic(from)
+
+	for _, name := range p.order {
+		dir := filepath.Join(to, name)
+		os.RemoveAll(dir)
+		os.MkdirAll(dir, 0755)
+	}
+
+	log.Info("Start staging files from %s to %s\n", from, to)
+	order := p.evalOrder()
+	filled, err := nonEmptyDirs(from)
+	if err != nil {
+		return err
+	}
+	if err := filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == from {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(from, path)
+		if info.IsDir() && filled[rel] {
+			return nil
+		}
+
+		for _, name := range order {
+			if !p.pkgs[name].Match(rel) {
+				continue
+			}
+			dest := filepath.Join(to, name, rel)
+			if info.IsDir() { // ship empty directory
+				return os.MkdirAll(dest, info.Mode())
+			}
+			return utils.Stage(path, dest)
+		}
+		log.Trace("%s is not shipped in any package", rel)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for name, pkg := range p.pkgs {
+		if err := pkg.prepareAlternatives(filepath.Join(to, name)); err != nil {
 			return err
 		}
+	}
+
+	split := ctx.Get("INHIBIT_PACKAGE_DEBUG_SPLIT") == nil
+	strip := ctx.Get("INHIBIT_PACKAGE_STRIP") == nil
+	if err := p.stripAndSplit(ctx, to, split, strip); err != nil {
+		return err
+	}
 
-		// TODO: pack
+	pkgdata := PkgdataDir(ctx.GetStr("PKGDATADIR"), ctx.GetStr("TARGETSYS"))
+	if err := RemoveRecords(pkgdata, ctrl.Source); err != nil {
+		return err
+	}
+	libs, err := p.resolveShlibs(ctx, to, pkgdata, ctrl)
+	if err != nil {
+		return err
+	}
+
+	for name, pkg := range p.pkgs {
+		r := &Record{
+			Package:  pkg.name,
+			Carton:   ctrl.Source,
+			Version:  pkg.Version(ctrl),
+			Arch:     ctrl.Architecture,
+			Depends:  pkg.depends,
+			Provides: pkg.provides,
+			Dir:      filepath.Join(to, name),
+
+			License:    ctrl.License,
+			LicenseDir: ctrl.LicenseDir,
+			Homepage:   ctrl.Homepage,
+			Sources:    ctrl.Sources,
+
+			Alternatives: pkg.alternatives,
+		}
+		if s, ok := libs[name]; ok {
+			r.Sonames, r.Needed = s.sonames, s.needed
+		}
+		if r.Files, err = scanFiles(filepath.Join(to, name)); err != nil {
+			return err
+		}
+		if err := WriteRecord(pkgdata, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalOrder returns packages by evaluation order: split packages firstly,
+// then others, both by order of creation
+func (p *Packages) evalOrder() []string {
+
+	order := make([]string, 0, len(p.order))
+	order = append(order, p.splits...)
+	for _, name := range p.order {
+		if !p.pkgs[name].isSplit {
+			order = append(order, name)
+		}
+	}
+	return order
+}
+
+// Pack archives packages staged under @from into directory @to
+// package archive is named as <package>_<version>_<arch>.ipk
+// package without any file is skipped. archives packed before are removed,
+// so feed doesn't have stale versions or packages which become empty
+func (p *Packages) Pack(from, to string, ctrl Control) error {
+
+	for _, name := range p.order {
+		pkg := p.pkgs[name]
+		old, _ := filepath.Glob(filepath.Join(to, fmt.Sprintf("%s_*_%s.ipk",
+			pkg.name, ctrl.Architecture)))
+		for _, ipk := range old {
+			log.Trace("Remove stale package %s", ipk)
+			if err := os.Remove(ipk); err != nil {
+				return err
+			}
+		}
+
+		dir := filepath.Join(from, name)
+		if isEmpty(dir) {
+			log.Trace("Skip packing empty package %s", pkg.name)
+			continue
+		}
+
+		ver := pkg.Version(ctrl)
+		if i := strings.Index(ver, ":"); i >= 0 {
+			ver = ver[i+1:] // epoch is not part of file name
+		}
+		ipk := filepath.Join(to, fmt.Sprintf("%s_%s_%s.ipk",
+			pkg.name, ver, ctrl.Architecture))
+		log.Info("Pack %s into %s\n", dir, ipk)
+		if err := packIpk(dir, ipk, pkg.controlFiles(ctrl)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// nonEmptyDirs returns directories under @root which have any file except
+// directory, key is path relative to @root. it walks @root only once
+func nonEmptyDirs(root string) (map[string]bool, error) {
+
+	dirs := map[string]bool{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		// ancestors are marked already if parent is marked
+		for dir := filepath.Dir(rel); !dirs[dir]; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+			if dir == "." {
+				break
+			}
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// isEmpty returns whether directory @dir has no file except directory
+func isEmpty(dir string) bool {
+
+	empty := true
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			empty = false
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return empty
+}
@@ -0,0 +1,135 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNonEmptyDirs(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, dir := range []string{"usr/lib/modules/kernel/drivers", "var/empty", "etc"} {
+		os.MkdirAll(filepath.Join(root, dir), 0755)
+	}
+	ioutil.WriteFile(filepath.Join(root, "usr/lib/modules/kernel/drivers/foo.ko"), nil, 0644)
+	os.Symlink("foo.ko", filepath.Join(root, "usr/lib/modules/bar.ko"))
+	ioutil.WriteFile(filepath.Join(root, "etc/foo.conf"), nil, 0644)
+
+	dirs, err := nonEmptyDirs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		".":                              true,
+		"usr":                            true,
+		"usr/lib":                        true,
+		"usr/lib/modules":                true,
+		"usr/lib/modules/kernel":         true,
+		"usr/lib/modules/kernel/drivers": true,
+		"etc":                            true,
+	}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("nonEmptyDirs() = %v, want %v", dirs, want)
+	}
+
+	// empty directory var/empty is the only one shipped as directory
+	for rel := range want {
+		if isEmpty(filepath.Join(root, rel)) {
+			t.Errorf("isEmpty(%s) disagrees with nonEmptyDirs", rel)
+		}
+	}
+	if !isEmpty(filepath.Join(root, "var/empty")) || dirs["var"] || dirs["var/empty"] {
+		t.Errorf("var/empty should be empty")
+	}
+}
+
+func TestPackRemovesStale(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	from, to := filepath.Join(tmp, "packages"), filepath.Join(tmp, "feed")
+	os.MkdirAll(filepath.Join(from, "foo/usr/bin"), 0755)
+	os.MkdirAll(filepath.Join(from, "foo-dev"), 0755)
+	os.MkdirAll(to, 0755)
+	ioutil.WriteFile(filepath.Join(from, "foo/usr/bin/foo"), []byte("foo"), 0755)
+	for _, name := range []string{"foo_0.9_arm.ipk", "foo-dev_0.9_arm.ipk",
+		"foo_0.9_x86.ipk", "foobar_0.9_arm.ipk"} {
+		ioutil.WriteFile(filepath.Join(to, name), nil, 0644)
+	}
+
+	var p Packages
+	p.NewPkg("foo")
+	p.NewPkg("foo-dev")
+	if err := p.Pack(from, to, Control{Version: "1.0", Architecture: "arm"}); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, _ := ioutil.ReadDir(to)
+	got := []string{}
+	for _, info := range infos {
+		got = append(got, info.Name())
+	}
+	// other arch and other package are kept, empty foo-dev isn't packed
+	want := []string{"foo_0.9_x86.ipk", "foo_1.0_arm.ipk", "foobar_0.9_arm.ipk"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("feed has %v, want %v", got, want)
+	}
+}
+
+func TestControlMultiLine(t *testing.T) {
+
+	p := newPkg("foo")
+	got := string(p.control(Control{Version: "1.0", Architecture: "arm",
+		Description: "foo tool\nfoo does things.\n\nsee foo(1)\n"}))
+	want := "Package: foo\nVersion: 1.0\nArchitecture: arm\n" +
+		"Description: foo tool\n foo does things.\n .\n see foo(1)\n"
+	if got != want {
+		t.Errorf("control() = %q, want %q", got, want)
+	}
+}
+
+func TestRemoveRecords(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pkgdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, r := range []*Record{
+		{Package: "foo", Carton: "foo"},
+		{Package: "foo-old", Carton: "foo"},
+		{Package: "bar", Carton: "bar"},
+	} {
+		if err := WriteRecord(dir, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RemoveRecords(dir, "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadRecords(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Package != "bar" {
+		t.Errorf("records of carton foo are not removed: %v", records)
+	}
+}
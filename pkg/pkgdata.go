@@ -0,0 +1,192 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"skygo/fetch"
+)
+
+// Record holds data of one package, which is shared across the build under
+// PKGDATADIR/<TARGETSYS>/<package>.json
+type Record struct {
+	Package  string   `json:"package"`
+	Carton   string   `json:"carton"`
+	Version  string   `json:"version"`
+	Arch     string   `json:"arch"`
+	Sonames  []string `json:"sonames,omitempty"`  // provided shared libraries
+	Needed   []string `json:"needed,omitempty"`   // DT_NEEDED shared libraries
+	Depends  []string `json:"depends,omitempty"`  // runtime dependencies
+	Provides []string `json:"provides,omitempty"` // virtual packages
+
+	Dir string `json:"dir"` // where files of package are staged, i.e. PKGD/<package>
+
+	License    string         `json:"license,omitempty"`
+	LicenseDir string         `json:"license_dir,omitempty"` // verified license texts
+	Homepage   string         `json:"homepage,omitempty"`
+	Sources    []fetch.Source `json:"sources,omitempty"` // source of carton
+
+	Alternatives []Alternative `json:"alternatives,omitempty"`
+
+	Files []File `json:"files,omitempty"`
+}
+
+// File is one file shipped in package
+type File struct {
+	Path string `json:"path"` // absolute path on target
+	Size int64  `json:"size"`
+	Mode string `json:"mode"`           // e.g. -rwxr-xr-x
+	Link string `json:"link,omitempty"` // target of symbol link
+}
+
+// Owns returns file @path shipped in package, @path can be glob pattern
+func (r *Record) Owns(path string) []File {
+
+	files := []File{}
+	for _, f := range r.Files {
+		if matched, _ := filepath.Match(path, f.Path); matched || f.Path == path {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// PkgdataDir returns directory of package data for system @sys
+func PkgdataDir(pkgdatadir, sys string) string {
+	return filepath.Join(pkgdatadir, sys)
+}
+
+// Systems returns all systems which have package data under @pkgdatadir
+func Systems(pkgdatadir string) ([]string, error) {
+
+	infos, err := ioutil.ReadDir(pkgdatadir)
+	if err != nil {
+		return nil, err
+	}
+
+	systems := []string{}
+	for _, info := range infos {
+		if info.IsDir() {
+			systems = append(systems, info.Name())
+		}
+	}
+	return systems, nil
+}
+
+// scanFiles lists files of package staged under directory @dir
+func scanFiles(dir string) ([]File, error) {
+
+	filled, err := nonEmptyDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []File{}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		if info.IsDir() && filled[rel] {
+			return nil
+		}
+		f := File{Path: "/" + rel, Mode: info.Mode().String()}
+		if info.Mode()&os.ModeSymlink != 0 {
+			f.Link, _ = os.Readlink(path)
+		} else if info.Mode().IsRegular() {
+			f.Size = info.Size()
+		}
+		files = append(files, f)
+		return nil
+	})
+	return files, err
+}
+
+// WriteRecord saves record @r into directory @dir
+func WriteRecord(dir string, r *Record) error {
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // keep version constraint readable, e.g. (>= 1.0)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+
+	os.MkdirAll(dir, 0755)
+	// other cartons may read in parallel, write into temp file then rename
+	file := filepath.Join(dir, r.Package+".json")
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// RemoveRecords removes records of packages produced by @carton from directory
+// @dir, so packages which carton no longer produces don't remain
+func RemoveRecords(dir, carton string) error {
+
+	records, err := ReadRecords(dir)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if r.Carton != carton {
+			continue
+		}
+		err := os.Remove(filepath.Join(dir, r.Package+".json"))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRecord loads record of package @name from directory @dir
+func ReadRecord(dir, name string) (*Record, error) {
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(Record)
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadRecords loads all records under directory @dir
+func ReadRecords(dir string) ([]*Record, error) {
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*Record{}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		r, err := ReadRecord(dir, name)
+		if os.IsNotExist(err) { // removed by packaging in parallel
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
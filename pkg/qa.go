@@ -0,0 +1,300 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"skygo/runbook"
+	"skygo/utils/log"
+)
+
+// QA level
+const (
+	QAError   = "error"
+	QAWarning = "warning"
+	QAIgnore  = "ignore"
+)
+
+// QA check name
+// level of each check can be configured per carton by variable QA_<NAME>,
+// NAME is upper case of check name with '-' replaced by '_', e.g.
+// foo.Set("QA_INSTALLED_VS_SHIPPED", "ignore")
+const (
+	QAInstalledVsShipped = "installed-vs-shipped"
+	QAArch               = "arch"
+	QARpaths             = "rpaths"
+	QABuildPaths         = "buildpaths"
+	QAWorldWritable      = "world-writable"
+	QABrokenSymlinks     = "broken-symlinks"
+	QAEmptyPackages      = "empty-packages"
+	QADevSo              = "dev-so"
+)
+
+var qaDefaultLevel = map[string]string{
+	QAInstalledVsShipped: QAWarning,
+	QAArch:               QAError,
+	QARpaths:             QAError,
+	QABuildPaths:         QAWarning,
+	QAWorldWritable:      QAWarning,
+	QABrokenSymlinks:     QAWarning,
+	QAEmptyPackages:      QAWarning,
+	QADevSo:              QAWarning,
+}
+
+// TARGETARCH to ELF machine
+var qaMachines = map[string]elf.Machine{
+	"arm":     elf.EM_ARM,
+	"arm64":   elf.EM_AARCH64,
+	"aarch64": elf.EM_AARCH64,
+	"386":     elf.EM_386,
+	"i386":    elf.EM_386,
+	"i586":    elf.EM_386,
+	"i686":    elf.EM_386,
+	"x86":     elf.EM_386,
+	"amd64":   elf.EM_X86_64,
+	"x86_64":  elf.EM_X86_64,
+	"mips":    elf.EM_MIPS,
+	"mipsel":  elf.EM_MIPS,
+	"mips64":  elf.EM_MIPS,
+	"ppc":     elf.EM_PPC,
+	"powerpc": elf.EM_PPC,
+	"ppc64":   elf.EM_PPC64,
+	"riscv32": elf.EM_RISCV,
+	"riscv64": elf.EM_RISCV,
+}
+
+type qaIssue struct {
+	check string
+	msg   string
+}
+
+type qa struct {
+	ctx    runbook.Context
+	issues []qaIssue
+}
+
+func (q *qa) level(check string) string {
+
+	key := "QA_" + strings.ToUpper(strings.Replace(check, "-", "_", -1))
+	if level := q.ctx.GetStr(key); level != "" {
+		return level
+	}
+	return qaDefaultLevel[check]
+}
+
+func (q *qa) report(check, format string, v ...interface{}) {
+
+	if q.level(check) == QAIgnore {
+		return
+	}
+	q.issues = append(q.issues, qaIssue{check: check, msg: fmt.Sprintf(format, v...)})
+}
+
+// QA checks files installed under @from and packaged under @to
+// Issue of check with level error fails QA, issue of check with level warning
+// is only reported. Refer to QA check name for all checks
+func (p *Packages) QA(ctx runbook.Context, from, to string) error {
+
+	q := &qa{ctx: ctx}
+
+	p.qaShipped(q, from, to)
+
+	for _, name := range p.order {
+		root := filepath.Join(to, name)
+		p.qaEmpty(q, name, root)
+
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			where := fmt.Sprintf("%s: /%s", name, rel)
+
+			if info.Mode()&os.ModeSymlink != 0 {
+				qaSymlink(q, where, root, path)
+				return nil
+			}
+			if info.Mode()&0002 != 0 {
+				q.report(QAWorldWritable, "%s is world-writable", where)
+			}
+			if name == p.owner {
+				qaDevSo(q, where, rel)
+			}
+			qaContent(q, where, path)
+			return nil
+		})
+	}
+
+	stdout, _ := ctx.Output()
+	failed := []string{}
+	for _, issue := range q.issues {
+		msg := fmt.Sprintf("QA %s: %s", issue.check, issue.msg)
+		fmt.Fprintln(stdout, msg)
+		if q.level(issue.check) == QAError {
+			failed = append(failed, msg)
+		} else {
+			log.Warning("%s: %s", ctx.Owner(), msg)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%s failed on package QA:\n\t%s", ctx.Owner(),
+			strings.Join(failed, "\n\t"))
+	}
+	return nil
+}
+
+// qaShipped reports files installed under @from but not shipped in any package
+func (p *Packages) qaShipped(q *qa, from, to string) {
+
+	// links managed by alternatives are not shipped intentionally
+	links := map[string]bool{}
+	for _, pkg := range p.pkgs {
+		for _, alt := range pkg.alternatives {
+			links[strings.TrimPrefix(alt.Link, "/")] = true
+		}
+	}
+
+	notShipped := []string{}
+	filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, _ := filepath.Rel(from, path)
+		if links[rel] {
+			return nil
+		}
+		for _, name := range p.order {
+			if _, err := os.Lstat(filepath.Join(to, name, rel)); err == nil {
+				return nil
+			}
+		}
+		notShipped = append(notShipped, "/"+rel)
+		return nil
+	})
+
+	sort.Strings(notShipped)
+	for _, f := range notShipped {
+		q.report(QAInstalledVsShipped, "%s is installed but not shipped in any package", f)
+	}
+}
+
+// qaEmpty reports package which has no file unless it's allowed to be empty
+func (p *Packages) qaEmpty(q *qa, name, root string) {
+
+	if !p.pkgs[name].allowEmpty && isEmpty(root) {
+		q.report(QAEmptyPackages, "package %s is empty", name)
+	}
+}
+
+// qaSymlink reports symbol link whose target does not exist in package
+func qaSymlink(q *qa, where, root, path string) {
+
+	link, err := os.Readlink(path)
+	if err != nil {
+		return
+	}
+
+	target := link
+	if filepath.IsAbs(link) {
+		target = filepath.Join(root, link)
+	} else {
+		target = filepath.Join(filepath.Dir(path), link)
+	}
+
+	// target may be shipped in another package, e.g. libz.so -> libz.so.1
+	// so search all packages
+	rel, err := filepath.Rel(root, target)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		q.report(QABrokenSymlinks, "%s points to %s outside of package", where, link)
+		return
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(root), "*", rel))
+	if len(matches) == 0 {
+		q.report(QABrokenSymlinks, "%s is broken symbol link to %s", where, link)
+	}
+}
+
+// qaDevSo reports development files in main package
+func qaDevSo(q *qa, where, rel string) {
+
+	base, dir := filepath.Base(rel), filepath.Dir(rel)
+	switch {
+	case strings.HasSuffix(base, ".so") && (dir == "usr/lib" || dir == "lib"):
+		// unversioned shared library at top level of libdir
+	case strings.HasSuffix(base, ".la"), strings.HasSuffix(base, ".a"),
+		strings.HasSuffix(base, ".h"), strings.HasSuffix(base, ".pc"):
+	default:
+		return
+	}
+	q.report(QADevSo, "%s is development file, it should be shipped in -dev", where)
+}
+
+// qaContent checks ELF machine, RPATH and build paths in file @path
+func qaContent(q *qa, where, path string) {
+
+	buildPaths := []string{}
+	for _, key := range []string{"WORKDIR", "BUILDIR"} {
+		if v := q.ctx.GetStr(key); v != "" {
+			buildPaths = append(buildPaths, v)
+		}
+	}
+
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+
+		if want, ok := qaMachines[q.ctx.GetStr("TARGETARCH")]; ok && f.Machine != want {
+			q.report(QAArch, "%s is built for %s, but TARGETARCH is %s",
+				where, f.Machine, q.ctx.GetStr("TARGETARCH"))
+		}
+
+		for _, tag := range []elf.DynTag{elf.DT_RPATH, elf.DT_RUNPATH} {
+			rpaths, _ := f.DynString(tag)
+			for _, rpath := range rpaths {
+				for _, p := range buildPaths {
+					if strings.Contains(rpath, p) {
+						q.report(QARpaths, "%s has %s %s refers to build directory",
+							where, tag, rpath)
+						break
+					}
+				}
+			}
+		}
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	if bytes.IndexByte(head[:n], 0) >= 0 {
+		return // binary file
+	}
+	file.Seek(0, io.SeekStart)
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, file); err != nil {
+		return
+	}
+	for _, p := range buildPaths {
+		if bytes.Contains(buf.Bytes(), []byte(p)) {
+			q.report(QABuildPaths, "%s refers to build directory %s", where, p)
+			return
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"skygo/utils"
+)
+
+// parseRelation splits relationship "name (op version)" into parts
+func parseRelation(rel string) (name, op, ver string) {
+
+	rel = strings.TrimSpace(rel)
+	name = relationName(rel)
+	if i, j := strings.Index(rel, "("), strings.LastIndex(rel, ")"); i >= 0 && j > i {
+		if fields := strings.Fields(rel[i+1 : j]); len(fields) == 2 {
+			op, ver = fields[0], fields[1]
+		}
+	}
+	return
+}
+
+// resolver finds packages satisfying relationships among package data
+type resolver struct {
+	byName   map[string]*Record
+	provided map[string][]*Record
+	sonames  map[string]*Record
+}
+
+func newResolver(records []*Record) *resolver {
+
+	r := &resolver{
+		byName:   map[string]*Record{},
+		provided: map[string][]*Record{},
+		sonames:  map[string]*Record{},
+	}
+	for _, rec := range records {
+		r.byName[rec.Package] = rec
+		for _, p := range rec.Provides {
+			name := relationName(p)
+			r.provided[name] = append(r.provided[name], rec)
+		}
+		for _, soname := range rec.Sonames {
+			r.sonames[soname] = rec
+		}
+	}
+	return r
+}
+
+// find finds package satisfying relationship @rel
+func (r *resolver) find(rel string) (*Record, error) {
+
+	name, op, ver := parseRelation(rel)
+	if rec, ok := r.byName[name]; ok {
+		if op != "" && !SatisfyVersion(rec.Version, op, ver) {
+			return nil, fmt.Errorf("%s is not satisfied by version %s", rel, rec.Version)
+		}
+		return rec, nil
+	}
+	switch candidates := r.provided[name]; len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("%s is not found in package data", name)
+	case 1:
+		return candidates[0], nil
+	default:
+		names := []string{}
+		for _, rec := range candidates {
+			names = append(names, rec.Package)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%s is provided by %s, install one explicitly",
+			name, strings.Join(names, ", "))
+	}
+}
+
+// depends returns packages required by package @rec, for dependency "a | b",
+// the first one which can be satisfied is selected. needed shared libraries
+// are resolved by packages providing them too
+func (r *resolver) depends(rec *Record) ([]*Record, error) {
+
+	deps := []*Record{}
+	for _, dep := range rec.Depends {
+		var (
+			found *Record
+			err   error
+		)
+		for _, alt := range strings.Split(dep, "|") {
+			if found, err = r.find(alt); err == nil {
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("package %s depends on %s", rec.Package, err)
+		}
+		deps = append(deps, found)
+	}
+	for _, lib := range rec.Needed {
+		if found, ok := r.sonames[lib]; ok && found != rec {
+			deps = append(deps, found)
+		}
+	}
+	return deps, nil
+}
+
+// Closure resolves packages @install and their runtime dependencies by
+// package data @records. dependency is satisfied by package of the same name
+// or package providing it, version constraint is checked only on real package.
+// for dependency "a | b", the first one which can be satisfied is selected.
+// needed shared libraries are resolved by packages providing them too.
+// It returns records of all packages sorted by name
+func Closure(records []*Record, install []string) ([]*Record, error) {
+
+	r := newResolver(records)
+
+	selected := map[string]*Record{}
+	queue := []*Record{}
+	add := func(rec *Record) {
+		if _, ok := selected[rec.Package]; !ok {
+			selected[rec.Package] = rec
+			queue = append(queue, rec)
+		}
+	}
+
+	for _, name := range install {
+		rec, err := r.find(name)
+		if err != nil {
+			return nil, err
+		}
+		add(rec)
+	}
+
+	for len(queue) > 0 {
+		rec := queue[0]
+		queue = queue[1:]
+
+		deps, err := r.depends(rec)
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range deps {
+			add(dep)
+		}
+	}
+
+	closure := make([]*Record, 0, len(selected))
+	for _, rec := range selected {
+		closure = append(closure, rec)
+	}
+	sort.Slice(closure, func(i, j int) bool {
+		return closure[i].Package < closure[j].Package
+	})
+	return closure, nil
+}
+
+// InstallRootfs installs files of packages @records into @rootfs which is
+// cleaned firstly. files installed by more than one package are reported by
+// utils.ConflictError, and links of alternatives are created at last.
+// maintainer scripts are not run
+func InstallRootfs(rootfs string, records []*Record) error {
+
+	os.RemoveAll(rootfs)
+	os.MkdirAll(rootfs, 0755)
+
+	owners := new(utils.Owners)
+	alts := []Alternative{}
+	for _, r := range records {
+		for _, alt := range r.Alternatives {
+			owners.Reserve(alt.Link)
+		}
+		alts = append(alts, r.Alternatives...)
+	}
+
+	conflicts := []string{}
+	for _, r := range records {
+		if r.Dir == "" {
+			return fmt.Errorf("package data of %s is outdated, rebuild carton %s",
+				r.Package, r.Carton)
+		}
+		if err := owners.Stage(r.Package, r.Dir, rootfs); err != nil {
+			if e, ok := err.(*utils.ConflictError); ok {
+				conflicts = append(conflicts, e.Conflicts...)
+				continue
+			}
+			return fmt.Errorf("package %s: %s", r.Package, err)
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return &utils.ConflictError{Conflicts: conflicts}
+	}
+
+	return ApplyAlternatives(rootfs, alts)
+}
+
+// WriteManifest writes installed packages @records into @file, one package
+// per line: name version arch
+func WriteManifest(file string, records []*Record) error {
+
+	var b strings.Builder
+	for _, r := range records {
+		fmt.Fprintf(&b, "%s %s %s\n", r.Package, r.Version, r.Arch)
+	}
+	return ioutil.WriteFile(file, []byte(b.String()), 0644)
+}
@@ -0,0 +1,145 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"skygo/runbook"
+	"skygo/utils/log"
+)
+
+// shlibs holds shared library information of one package
+type shlibs struct {
+	sonames []string
+	needed  []string
+}
+
+// scanShlibs collects sonames provided and DT_NEEDED libraries required by ELF
+// files under directory @dir
+func scanShlibs(dir string) (*shlibs, error) {
+
+	provided := map[string]bool{}
+	needed := map[string]bool{}
+
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".debug" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := elf.Open(path)
+		if err != nil {
+			return nil // not ELF
+		}
+		defer f.Close()
+
+		if sonames, err := f.DynString(elf.DT_SONAME); err == nil {
+			for _, soname := range sonames {
+				provided[soname] = true
+			}
+		}
+		if libs, err := f.ImportedLibraries(); err == nil {
+			for _, lib := range libs {
+				needed[lib] = true
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	s := new(shlibs)
+	for soname := range provided {
+		s.sonames = append(s.sonames, soname)
+	}
+	for lib := range needed {
+		if !provided[lib] {
+			s.needed = append(s.needed, lib)
+		}
+	}
+	sort.Strings(s.sonames)
+	sort.Strings(s.needed)
+	return s, nil
+}
+
+// resolveShlibs detects shared libraries of packages staged under @to, and
+// adds runtime dependencies on packages who provide needed libraries. libraries
+// are searched in packages of this carton firstly, then in package data
+// recorded under @pkgdata by other cartons across the build. libraries listed
+// in SHLIBS_ASSUME_PROVIDED are not warned if no package provides them
+func (p *Packages) resolveShlibs(ctx runbook.Context, to, pkgdata string,
+	ctrl Control) (map[string]*shlibs, error) {
+
+	libs := map[string]*shlibs{}
+	providers := map[string]string{} // soname -> package
+	versions := map[string]string{}  // package -> version
+
+	records, _ := ReadRecords(pkgdata)
+	for _, r := range records {
+		if r.Carton == ctrl.Source {
+			continue // stale record of this carton
+		}
+		for _, soname := range r.Sonames {
+			providers[soname] = r.Package
+		}
+		versions[r.Package] = r.Version
+	}
+
+	for name, pkg := range p.pkgs {
+		if name == p.owner+DBG {
+			continue
+		}
+		s, err := scanShlibs(filepath.Join(to, name))
+		if err != nil {
+			return nil, err
+		}
+		libs[name] = s
+		for _, soname := range s.sonames {
+			providers[soname] = pkg.name
+		}
+		versions[pkg.name] = pkg.Version(ctrl)
+	}
+
+	// libraries provided outside of the build, e.g. by external toolchain
+	assumed := map[string]bool{}
+	for _, lib := range strings.Fields(ctx.GetStr("SHLIBS_ASSUME_PROVIDED")) {
+		assumed[lib] = true
+	}
+
+	for name, s := range libs {
+		pkg := p.pkgs[name]
+		for _, lib := range s.needed {
+			provider, ok := providers[lib]
+			if !ok {
+				if assumed[lib] {
+					continue
+				}
+				log.Warning("%s: package %s requires %s, but no package provides it",
+					ctx.Owner(), pkg.name, lib)
+				continue
+			}
+			if provider == pkg.name {
+				continue
+			}
+			log.Trace("Package %s depends on %s since %s", pkg.name, provider, lib)
+			pkg.Depends(fmt.Sprintf("%s (>= %s)", provider, versions[provider]))
+		}
+	}
+	return libs, nil
+}
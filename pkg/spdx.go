@@ -0,0 +1,273 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const noassertion = "NOASSERTION"
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files,omitempty"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	Supplier         string            `json:"supplier,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	VerificationCode *spdxVerification `json:"packageVerificationCode,omitempty"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	Homepage         string            `json:"homepage,omitempty"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	Purpose          string            `json:"primaryPackagePurpose,omitempty"`
+}
+
+type spdxVerification struct {
+	Value string `json:"packageVerificationCodeValue"`
+}
+
+type spdxChecksum struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"checksumValue"`
+}
+
+type spdxFile struct {
+	SPDXID           string         `json:"SPDXID"`
+	FileName         string         `json:"fileName"`
+	Checksums        []spdxChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	CopyrightText    string         `json:"copyrightText"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+// spdxID makes SPDX identifier from @parts, characters other than letters,
+// numbers, '.' and '-' are replaced by '-'
+func spdxID(parts ...string) string {
+
+	id := strings.Join(parts, "-")
+	return "SPDXRef-" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '.', r == '-':
+			return r
+		}
+		return '-'
+	}, id)
+}
+
+// fileChecksums calculates SHA1 and SHA256 of file @path
+func fileChecksums(path string) (string, string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	h1, h256 := sha1.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h1, h256), f); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(h1.Sum(nil)), hex.EncodeToString(h256.Sum(nil)), nil
+}
+
+// spdxCreated returns creation time of document, SOURCE_DATE_EPOCH is used if
+// it's set to make document reproducible
+func spdxCreated() string {
+
+	t := time.Now()
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if sec, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			t = time.Unix(sec, 0)
+		}
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// WriteSPDX writes software bill of materials of image @name which installs
+// packages @records into @file, in SPDX 2.3 JSON format. every package lists
+// its version, license, carton, checksums of regular files and relationships
+// to other packages. each source URL of carton is described by one package
+// with its checksum or revision, which packages are generated from
+func WriteSPDX(file, name string, records []*Record) error {
+
+	doc := &spdxDocument{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        name,
+		CreationInfo: spdxCreationInfo{
+			Created:  spdxCreated(),
+			Creators: []string{"Tool: skygo"},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+	relate := func(element, typ, related string) {
+		doc.Relationships = append(doc.Relationships,
+			spdxRelationship{Element: element, Type: typ, Related: related})
+	}
+
+	// one package per source URL of carton, shared by packages of carton
+	sources := map[string][]string{}
+	for _, r := range records {
+		if _, ok := sources[r.Carton]; ok {
+			continue
+		}
+		ids := []string{}
+		for n, src := range r.Sources {
+			p := spdxPackage{
+				SPDXID:           spdxID("Source", r.Carton, strconv.Itoa(n)),
+				Name:             r.Carton,
+				VersionInfo:      r.Version,
+				DownloadLocation: src.URL,
+				LicenseConcluded: noassertion,
+				LicenseDeclared:  noassertion,
+				CopyrightText:    noassertion,
+				Purpose:          "SOURCE",
+			}
+			if r.License != "" {
+				p.LicenseDeclared = r.License
+			}
+			if src.Checksum != "" {
+				p.Checksums = []spdxChecksum{{Algorithm: "SHA256", Value: src.Checksum}}
+			}
+			if src.Revision != "" {
+				p.SourceInfo = "revision " + src.Revision
+			}
+			doc.Packages = append(doc.Packages, p)
+			ids = append(ids, p.SPDXID)
+		}
+		sources[r.Carton] = ids
+	}
+
+	res := newResolver(records)
+	for _, r := range records {
+
+		id := spdxID("Package", r.Package)
+		p := spdxPackage{
+			SPDXID:           id,
+			Name:             r.Package,
+			VersionInfo:      r.Version,
+			DownloadLocation: noassertion,
+			Homepage:         r.Homepage,
+			SourceInfo:       "built by carton " + r.Carton + " for " + r.Arch,
+			LicenseConcluded: noassertion,
+			LicenseDeclared:  noassertion,
+			CopyrightText:    noassertion,
+			Purpose:          "INSTALL",
+		}
+		if r.License != "" {
+			p.LicenseDeclared = r.License
+		}
+		if len(r.Sources) > 0 {
+			p.DownloadLocation = r.Sources[0].URL
+		}
+
+		sums := []string{}
+		for n, f := range r.Files {
+			if !strings.HasPrefix(f.Mode, "-") {
+				continue
+			}
+			sum1, sum256, err := fileChecksums(filepath.Join(r.Dir, f.Path))
+			if err != nil {
+				return fmt.Errorf("package %s: %s", r.Package, err)
+			}
+			fid := spdxID("File", r.Package, strconv.Itoa(n))
+			doc.Files = append(doc.Files, spdxFile{
+				SPDXID:   fid,
+				FileName: "." + f.Path,
+				Checksums: []spdxChecksum{
+					{Algorithm: "SHA1", Value: sum1},
+					{Algorithm: "SHA256", Value: sum256},
+				},
+				LicenseConcluded: noassertion,
+				CopyrightText:    noassertion,
+			})
+			relate(id, "CONTAINS", fid)
+			sums = append(sums, sum1)
+		}
+		if len(sums) > 0 {
+			// verification code defined by SPDX: SHA1 of sorted SHA1 of files
+			sort.Strings(sums)
+			h := sha1.Sum([]byte(strings.Join(sums, "")))
+			p.FilesAnalyzed = true
+			p.VerificationCode = &spdxVerification{Value: hex.EncodeToString(h[:])}
+		}
+		doc.Packages = append(doc.Packages, p)
+
+		relate("SPDXRef-DOCUMENT", "DESCRIBES", id)
+		for _, src := range sources[r.Carton] {
+			relate(id, "GENERATED_FROM", src)
+		}
+		deps, err := res.depends(r)
+		if err != nil {
+			return err
+		}
+		seen := map[string]bool{}
+		for _, dep := range deps {
+			if !seen[dep.Package] {
+				seen[dep.Package] = true
+				relate(id, "DEPENDS_ON", spdxID("Package", dep.Package))
+			}
+		}
+	}
+
+	// namespace is unique for content of document but creation time
+	var manifest strings.Builder
+	for _, r := range records {
+		fmt.Fprintf(&manifest, "%s %s %s\n", r.Package, r.Version, r.Arch)
+	}
+	sum := sha256.Sum256([]byte(manifest.String()))
+	doc.DocumentNamespace = fmt.Sprintf("http://spdx.org/spdxdocs/%s-%s",
+		name, hex.EncodeToString(sum[:8]))
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
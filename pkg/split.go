@@ -0,0 +1,129 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"skygo/runbook"
+	"skygo/utils"
+)
+
+// standard split packages, suffix of owner name
+const (
+	DBG       = "-dbg"
+	STATICDEV = "-staticdev"
+	DOC       = "-doc"
+	LOCALE    = "-locale"
+)
+
+// default split patterns. refer to utils.StageBox for pattern syntax
+var defaultSplits = []struct {
+	suffix   string
+	patterns []string
+}{
+	{DBG, []string{"usr/lib/debug", "usr/src/debug", "**/.debug/"}},
+	{STATICDEV, []string{"usr/lib/*.a", "lib/*.a"}},
+	{DOC, []string{"usr/share/doc", "usr/share/man", "usr/share/info",
+		"usr/share/gtk-doc"}},
+	{LOCALE, []string{"usr/share/locale", "usr/lib/locale"}},
+}
+
+// dynamic split rule, refer to SplitDynamic
+type dynamicSplit struct {
+	root    string
+	pattern *regexp.Regexp
+	format  string
+	modify  func(*Pkg)
+}
+
+// Split creates a split package @name which ships files matching @patterns
+// split packages are evaluated before other packages by order of creation,
+// file is shipped in the first matched package. refer to utils.StageBox for
+// pattern syntax. if split package @name exists, @patterns is appended
+func (p *Packages) Split(name string, patterns ...string) *Pkg {
+
+	pkg := p.GetPkg(name)
+	if pkg == nil {
+		pkg = p.NewPkg(name)
+	}
+
+	if !pkg.isSplit {
+		pkg.isSplit = true
+		p.splits = append(p.splits, name)
+	}
+
+	for _, pattern := range patterns {
+		pkg.Push(pattern)
+	}
+	return pkg
+}
+
+// SplitDynamic creates one package per file or directory under @root
+// whose name matches regular expression @pattern when packaging. package name
+// is fmt.Sprintf(@format, first submatch of @pattern). e.g. @root usr/lib/gconv,
+// @pattern `^(.*)\.so$` and @format glibc-gconv-%s create package
+// glibc-gconv-utf-16 for usr/lib/gconv/UTF-16.so
+// package name is converted to lower case. modify is optional, it's called
+// with generated package to update its metadata
+func (p *Packages) SplitDynamic(root, pattern, format string, modify func(*Pkg)) {
+
+	if filepath.IsAbs(root) {
+		panic("SplitDynamic rejects ABS path")
+	}
+
+	p.dynamics = append(p.dynamics, dynamicSplit{
+		root:    root,
+		pattern: regexp.MustCompile(pattern),
+		format:  format,
+		modify:  modify,
+	})
+}
+
+// expandDynamic creates split packages by scanning dynamic split rules
+func (p *Packages) expandDynamic(from string) {
+
+	for _, d := range p.dynamics {
+
+		dir, err := os.Open(filepath.Join(from, d.root))
+		if err != nil {
+			continue
+		}
+		names, _ := dir.Readdirnames(-1)
+		dir.Close()
+
+		for _, name := range names {
+			m := d.pattern.FindStringSubmatch(name)
+			if m == nil {
+				continue
+			}
+			stem := m[0]
+			if len(m) > 1 {
+				stem = m[1]
+			}
+			pkgname := strings.ToLower(fmt.Sprintf(d.format, stem))
+			isNew := p.GetPkg(pkgname) == nil
+
+			pkg := p.Split(pkgname, utils.EscapePattern(filepath.Join(d.root, name)))
+			if isNew {
+				pkg.Depends(p.nameOf(p.owner))
+				if d.modify != nil {
+					d.modify(pkg)
+				}
+			}
+		}
+	}
+}
+
+// run runs utility @name to process package files
+func run(ctx runbook.Context, name string, args ...string) error {
+
+	command := runbook.NewCommand(ctx, name, args...)
+	return command.Run(ctx, "package")
+}
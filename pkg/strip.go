@@ -0,0 +1,222 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"skygo/runbook"
+	"skygo/utils"
+	"skygo/utils/log"
+)
+
+// elfFile is one ELF file in packages, hard links are grouped together
+type elfFile struct {
+	paths []string // absolute paths, the first one is primary
+	rels  []string // paths relative to package root
+	kind  elf.Type
+	mode  os.FileMode
+}
+
+// KeepUnstripped marks files matching @patterns are not stripped
+// refer to utils.StageBox for pattern syntax
+func (p *Packages) KeepUnstripped(patterns ...string) {
+
+	if p.keep == nil {
+		p.keep = new(utils.StageBox)
+	}
+	for _, pattern := range patterns {
+		p.keep.Push(pattern)
+	}
+}
+
+// collectELF returns ELF files in packages staged under @to except -dbg
+// files sharing the same inode are grouped
+func (p *Packages) collectELF(to string) ([]*elfFile, error) {
+
+	files := []*elfFile{}
+	inodes := map[uint64]*elfFile{}
+
+	for _, name := range p.order {
+		if name == p.owner+DBG {
+			continue
+		}
+		root := filepath.Join(to, name)
+
+		if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if info.Name() == ".debug" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			rel, _ := filepath.Rel(root, path)
+			ino, nlink := inode(info)
+			if f, ok := inodes[ino]; ok && nlink > 1 {
+				f.paths = append(f.paths, path)
+				f.rels = append(f.rels, rel)
+				return nil
+			}
+
+			kind, ok := elfType(path)
+			if !ok {
+				return nil
+			}
+			f := &elfFile{
+				paths: []string{path},
+				rels:  []string{rel},
+				kind:  kind,
+				mode:  info.Mode(),
+			}
+			inodes[ino] = f
+			files = append(files, f)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// stripAndSplit processes ELF files in packages staged under @to
+//
+// if @split is true, debug information is separated into package -dbg. it's
+// saved into .debug sub-directory beside ELF file, and ELF file links to it
+// by section .gnu_debuglink
+//
+// if @strip is true, ELF files are stripped by strip of TARGETARCH, i.e.
+// ${CROSS_COMPILE}strip. kernel modules only have debug symbols stripped.
+// files marked by KeepUnstripped are skipped
+//
+// processed file is written into new file then renamed, so hard links to
+// image directory D are broken, but hard links between packaged files are
+// preserved
+func (p *Packages) stripAndSplit(ctx runbook.Context, to string, split, strip bool) error {
+
+	objcopy := ctx.GetStr("CROSS_COMPILE") + "objcopy"
+	if _, err := exec.LookPath(objcopy); split && err != nil {
+		log.Warning("%s: %s is not found, skip debug split", ctx.Owner(), objcopy)
+		split = false
+	}
+
+	stripcmd := ctx.GetStr("CROSS_COMPILE") + "strip"
+	if _, err := exec.LookPath(stripcmd); strip && err != nil {
+		log.Warning("%s: %s is not found, skip stripping", ctx.Owner(), stripcmd)
+		strip = false
+	}
+
+	if !split && !strip {
+		return nil
+	}
+
+	files, err := p.collectELF(to)
+	if err != nil {
+		return err
+	}
+
+	dbgdir := filepath.Join(to, p.owner+DBG)
+	for _, f := range files {
+
+		path := f.paths[0]
+		tmp := path + ".tmp"
+		os.Remove(tmp)
+
+		keep := p.keep != nil && p.keep.Match(f.rels[0])
+		processed := false
+
+		if strip && !keep {
+			args := []string{"--remove-section=.comment", "--remove-section=.note",
+				"--strip-unneeded"}
+			if f.kind == elf.ET_REL {
+				args = []string{"--strip-debug"} // kernel module
+			}
+			args = append(args, "-o", tmp, path)
+
+			log.Trace("Strip %s", f.rels[0])
+			if err := run(ctx, stripcmd, args...); err != nil {
+				os.Remove(tmp)
+				return err
+			}
+			processed = true
+		}
+
+		if split {
+			debug := filepath.Join(dbgdir, filepath.Dir(f.rels[0]), ".debug",
+				filepath.Base(f.rels[0]))
+			os.MkdirAll(filepath.Dir(debug), 0755)
+
+			log.Trace("Split debug information of %s into %s", f.rels[0], p.owner+DBG)
+			if err := run(ctx, objcopy, "--only-keep-debug", path, debug); err != nil {
+				return err
+			}
+
+			// other hard links also look up debug file beside themselves
+			for _, rel := range f.rels[1:] {
+				link := filepath.Join(dbgdir, filepath.Dir(rel), ".debug", filepath.Base(rel))
+				os.MkdirAll(filepath.Dir(link), 0755)
+				os.Remove(link)
+				os.Link(debug, link)
+			}
+
+			src := path
+			if processed {
+				src = tmp
+			}
+			out := tmp + ".debuglink"
+			if err := run(ctx, objcopy, "--add-gnu-debuglink="+debug, src, out); err != nil {
+				os.Remove(out)
+				return err
+			}
+			if err := os.Rename(out, tmp); err != nil {
+				return err
+			}
+			processed = true
+		}
+
+		if !processed {
+			continue
+		}
+
+		os.Chmod(tmp, f.mode)
+		if err := os.Rename(tmp, path); err != nil {
+			return err
+		}
+		for _, other := range f.paths[1:] {
+			os.Remove(other)
+			if err := os.Link(path, other); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// elfType returns type of ELF file @path
+// only executable, shared library or relocatable object like kernel module
+// is accepted
+func elfType(path string) (elf.Type, bool) {
+
+	f, err := elf.Open(path)
+	if err != nil {
+		return elf.ET_NONE, false
+	}
+	defer f.Close()
+
+	switch f.Type {
+	case elf.ET_EXEC, elf.ET_DYN, elf.ET_REL:
+		return f.Type, true
+	}
+	return elf.ET_NONE, false
+}
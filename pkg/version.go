@@ -0,0 +1,132 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"strings"
+)
+
+// CompareVersion compares version @a and @b like dpkg, version format is
+// [epoch:]upstream[-revision]. It returns -1, 0 or 1 if a is less than,
+// equal to or greater than b
+func CompareVersion(a, b string) int {
+
+	ea, ua, ra := splitVersion(a)
+	eb, ub, rb := splitVersion(b)
+
+	if c := compareFragment(ea, eb); c != 0 {
+		return c
+	}
+	if c := compareFragment(ua, ub); c != 0 {
+		return c
+	}
+	return compareFragment(ra, rb)
+}
+
+// SatisfyVersion returns whether version @v satisfies constraint @op @ver,
+// op is one of <<, <=, =, >=, >>
+func SatisfyVersion(v, op, ver string) bool {
+
+	c := CompareVersion(v, ver)
+	switch op {
+	case "<<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case "=":
+		return c == 0
+	case ">=":
+		return c >= 0
+	case ">>":
+		return c > 0
+	}
+	return false
+}
+
+func splitVersion(v string) (epoch, upstream, revision string) {
+
+	epoch = "0"
+	if i := strings.Index(v, ":"); i >= 0 {
+		epoch, v = v[:i], v[i+1:]
+	}
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		v, revision = v[:i], v[i+1:]
+	}
+	return epoch, v, revision
+}
+
+// order of non-digit character, '~' sorts before anything, even end of part
+func order(c byte) int {
+
+	switch {
+	case c >= '0' && c <= '9':
+		return 0
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+// compareFragment compares alternate non-digit and digit parts
+func compareFragment(a, b string) int {
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+
+		// non-digit part
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := 0, 0
+			if i < len(a) {
+				ac = order(a[i])
+			}
+			if j < len(b) {
+				bc = order(b[j])
+			}
+			if ac != bc {
+				if ac < bc {
+					return -1
+				}
+				return 1
+			}
+			i++
+			j++
+		}
+
+		// digit part
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		si, sj := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		na, nb := a[si:i], b[sj:j]
+		if len(na) != len(nb) {
+			if len(na) < len(nb) {
+				return -1
+			}
+			return 1
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,75 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import "testing"
+
+func TestCompareVersion(t *testing.T) {
+
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"01", "1", 0},
+		{"0:1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.9", "1.10", -1},
+		{"1.10", "1.9", 1},
+		{"1.0", "1.0.1", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0b", -1},
+		{"1.0a", "1.0+", -1}, // letters sort before other characters
+		{"1.0", "1.0+git", -1},
+		{"1.0~rc1", "1.0", -1}, // '~' sorts before end of version
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0~", "1.0", -1},
+		{"1:0.9", "2.0", 1}, // epoch wins
+		{"1:1.0", "2:0.1", -1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-r9", "1.0-r10", -1},
+		{"1.0-1", "1.0", 1},
+		{"2.6.32-1-2", "2.6.32-1-10", -1}, // revision follows the last '-'
+		{"2.6.32-2-1", "2.6.32-1-10", 1},
+	}
+
+	for _, test := range tests {
+		if got := CompareVersion(test.a, test.b); got != test.want {
+			t.Errorf("CompareVersion(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := CompareVersion(test.b, test.a); got != -test.want {
+			t.Errorf("CompareVersion(%s, %s) = %d, want %d", test.b, test.a, got, -test.want)
+		}
+	}
+}
+
+func TestSatisfyVersion(t *testing.T) {
+
+	tests := []struct {
+		v, op, ver string
+		want       bool
+	}{
+		{"1.0", "<<", "1.1", true},
+		{"1.1", "<<", "1.1", false},
+		{"1.1", "<=", "1.1", true},
+		{"1.2", "<=", "1.1", false},
+		{"1.1", "=", "1.1", true},
+		{"1.1", "=", "0:1.1", true},
+		{"1.1-r1", "=", "1.1", false},
+		{"1.1", ">=", "1.1", true},
+		{"1.0", ">=", "1.1", false},
+		{"1.2", ">>", "1.1", true},
+		{"1.1", ">>", "1.1", false},
+		{"1.1", "<", "1.2", false}, // unknown operator
+	}
+
+	for _, test := range tests {
+		if got := SatisfyVersion(test.v, test.op, test.ver); got != test.want {
+			t.Errorf("SatisfyVersion(%s, %s, %s) = %v, want %v",
+				test.v, test.op, test.ver, got, test.want)
+		}
+	}
+}
@@ -17,6 +17,8 @@ type KV struct {
 
 	// TODO: need lock  or use sync.Map ?
 	vars map[string]interface{}
+
+	overrides []Override // conditional assignments in order
 }
 
 // KVGetter holds metholds to read key-value
@@ -30,6 +32,86 @@ type KVSetter interface {
 	Set(key string, value interface{})
 }
 
+// KVOverrider holds methods to configure key-value conditionally
+// @when is a list of qualifiers with delimiter space, all of them must be
+// satisfied, empty @when is always satisfied. qualifiers are:
+//
+//	machine:<name>  MACHINE is <name>
+//	arch:<name>     TARGETARCH is <name>
+//	native          variant of carton built by host tools, e.g. native
+//	target          variant of carton built by cross tools, e.g. target
+//	variant:<name>  variant of carton is <name>, e.g. nativesdk
+//	feature:<name>  DISTRO_FEATURES contains <name>
+//
+// error is returned and nothing is assigned if @when has unknown qualifier
+type KVOverrider interface {
+
+	// Override sets value of @key if @when is satisfied
+	Override(when, key string, value interface{}) error
+
+	// Append appends @value to @key with delimiter space if @when is satisfied
+	Append(when, key, value string) error
+
+	// Prepend prepends @value to @key with delimiter space if @when is satisfied
+	Prepend(when, key, value string) error
+}
+
+// qualifiers of KVOverrider, true if qualifier has value, e.g. machine:<name>
+var qualifiers = map[string]bool{
+	"machine": true,
+	"arch":    true,
+	"native":  false,
+	"target":  false,
+	"variant": true,
+	"feature": true,
+}
+
+// ValidateWhen returns error if @when has unknown qualifier or qualifier
+// without value, refer to KVOverrider
+func ValidateWhen(when string) error {
+
+	for _, q := range strings.Fields(when) {
+		kind, value := q, ""
+		i := strings.Index(q, ":")
+		if i >= 0 {
+			kind, value = q[:i], q[i+1:]
+		}
+
+		hasValue, ok := qualifiers[kind]
+		switch {
+		case !ok:
+			return fmt.Errorf("unknown override qualifier %s", q)
+		case hasValue && value == "":
+			return fmt.Errorf("override qualifier %s needs value, e.g. %s:<name>", q, kind)
+		case !hasValue && i >= 0:
+			return fmt.Errorf("override qualifier %s has no value", kind)
+		}
+	}
+	return nil
+}
+
+// operations of Override
+const (
+	OpOverride = "override"
+	OpAppend   = "append"
+	OpPrepend  = "prepend"
+)
+
+// Override represents conditional assignment of key-value
+type Override struct {
+	Op    string
+	When  string
+	Key   string
+	Value interface{}
+}
+
+func (o Override) String() string {
+	if o.When == "" {
+		return fmt.Sprintf("%s %q", o.Op, o.Value)
+	}
+	return fmt.Sprintf("%s %q when %s", o.Op, o.Value, o.When)
+}
+
 // Init initialize KV that must be called firstly
 func (kv *KV) Init(name string) {
 	kv.vars = make(map[string]interface{})
@@ -70,6 +152,96 @@ func (kv *KV) Set(key string, value interface{}) {
 	kv.vars[key] = value
 }
 
+// Override sets value of @key if @when is satisfied, refer to KVOverrider
+func (kv *KV) Override(when, key string, value interface{}) error {
+	return kv.addOverride(Override{OpOverride, when, key, value})
+}
+
+// Append appends @value to @key if @when is satisfied, refer to KVOverrider
+func (kv *KV) Append(when, key, value string) error {
+	return kv.addOverride(Override{OpAppend, when, key, value})
+}
+
+// Prepend prepends @value to @key if @when is satisfied, refer to KVOverrider
+func (kv *KV) Prepend(when, key, value string) error {
+	return kv.addOverride(Override{OpPrepend, when, key, value})
+}
+
+// addOverride adds @o if its qualifiers are valid
+func (kv *KV) addOverride(o Override) error {
+
+	if err := ValidateWhen(o.When); err != nil {
+		return fmt.Errorf("%s of %s: %s", o.Op, o.Key, err)
+	}
+	kv.overrides = append(kv.overrides, o)
+	return nil
+}
+
+// Overrides returns conditional assignments in order
+func (kv *KV) Overrides() []Override {
+	return kv.overrides
+}
+
+// Lookup retrieves value of var key without logging if it's not found
+func (kv *KV) Lookup(key string) (interface{}, bool) {
+	v, ok := kv.vars[key]
+	return v, ok
+}
+
+// Resolve evaluates @overrides of @key on @value, @qualified reports whether
+// one qualifier is satisfied.
+// the most specific override wins, i.e. the one having the most qualifiers.
+// if several are equal specific, the last one wins. and then append and
+// prepend are applied in order. it returns the final value and overrides
+// which take effect
+func Resolve(overrides []Override, key string, value interface{},
+	qualified func(string) bool) (interface{}, []Override) {
+
+	satisfied := func(when string) bool {
+		for _, q := range strings.Fields(when) {
+			if !qualified(q) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var won *Override
+	for i, o := range overrides {
+		if o.Key != key || o.Op != OpOverride || !satisfied(o.When) {
+			continue
+		}
+		if won == nil || len(strings.Fields(o.When)) >= len(strings.Fields(won.When)) {
+			won = &overrides[i]
+		}
+	}
+
+	applied := []Override{}
+	if won != nil {
+		value = won.Value
+		applied = append(applied, *won)
+	}
+
+	for _, o := range overrides {
+		if o.Key != key || o.Op == OpOverride || !satisfied(o.When) {
+			continue
+		}
+		v, _ := value.(string)
+		add := o.Value.(string)
+		switch {
+		case v == "":
+			v = add
+		case o.Op == OpAppend:
+			v = v + " " + add
+		default:
+			v = add + " " + v
+		}
+		value = v
+		applied = append(applied, o)
+	}
+	return value, applied
+}
+
 // Range interates each item of key-value
 func (kv *KV) Range(f func(key, value string)) {
 
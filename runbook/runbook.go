@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -210,6 +211,22 @@ func (rb *Runbook) NewTaskForce(name string, task interface{}, summary string) *
 	return tf
 }
 
+// TaskForces return names of all task forces sorted by name
+func (rb *Runbook) TaskForces() []string {
+
+	names := make([]string, 0, len(rb.taskForce))
+	for name := range rb.taskForce {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TaskForce find task force by @name
+func (rb *Runbook) TaskForce(name string) *TaskForce {
+	return rb.taskForce[name]
+}
+
 // HasTaskForce return whether runbook has task force @name
 func (rb *Runbook) HasTaskForce(name string) bool {
 
@@ -343,6 +360,14 @@ func (s *Stage) Disable() *Stage {
 	return s
 }
 
+// Disabled returns whether stage is disabled
+func (s *Stage) Disabled() bool {
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.disabled
+}
+
 // InsertAfter insert a new stage @name after current one
 // Return new stage
 func (s *Stage) InsertAfter(name string) *Stage {
@@ -398,6 +423,16 @@ func (s *Stage) DelTask(weight int) *Stage {
 	return s
 }
 
+// Len returns the number of tasks in stage's taskset
+func (s *Stage) Len() int {
+	return s.taskset.Len()
+}
+
+// Scripts returns scripts of stage's taskset, refer to TaskSet.Add
+func (s *Stage) Scripts() []string {
+	return s.taskset.scripts()
+}
+
 // Reset clear executed status, then s.Play can be run again
 func (s *Stage) Reset(ctx Context) {
 
@@ -420,6 +455,20 @@ func (s *Stage) AddDep(d string,
 	return s
 }
 
+// Depends return dependent stages added by AddDep
+// format of each one: runbookName[@stageName]
+func (s *Stage) Depends() []string {
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	deps := make([]string, 0, len(s.depends))
+	for _, d := range s.depends {
+		deps = append(deps, d.runbook)
+	}
+	return deps
+}
+
 // Wait return channel for waiting this stage is finished
 // nofier will be invoked when
 // 1. stage had been executed. and iterats notifier chain here
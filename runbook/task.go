@@ -107,6 +107,19 @@ func (t *TaskSet) Del(key interface{}) {
 	delete(t.set, key)
 }
 
+// scripts returns scripts of task, which are script file names or strings
+func (t *TaskSet) scripts() []string {
+
+	scripts := []string{}
+	for _, v := range t.set {
+		if tc, ok := v.(taskCmd); ok {
+			scripts = append(scripts, tc.script)
+		}
+	}
+	sort.Strings(scripts)
+	return scripts
+}
+
 // play run all tasks by order of Sort.Ints(weight)
 func (t *TaskSet) play(ctx Context) error {
 
@@ -227,3 +240,18 @@ func (tf *TaskForce) AddDep(d string) *TaskForce {
 	tf.depends = append(tf.depends, d)
 	return tf
 }
+
+// Depends return dependent stages added by AddDep
+func (tf *TaskForce) Depends() []string {
+	return tf.depends
+}
+
+// Scripts return scripts of TaskForce, refer to TaskSet.Add
+func (tf *TaskForce) Scripts() []string {
+	return tf.taskset.scripts()
+}
+
+// Summary return help message of TaskForce
+func (tf *TaskForce) Summary() string {
+	return tf.summary
+}
@@ -26,6 +26,23 @@ func CopyFile(name string, mode os.FileMode, r io.Reader) error {
 	return nil
 }
 
+// CopyTree copies regular files under directory @from into @to
+func CopyTree(from, to string) error {
+
+	return filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, _ := filepath.Rel(from, path)
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return CopyFile(filepath.Join(to, rel), info.Mode().Perm(), f)
+	})
+}
+
 // CreateSymbolicLink create symbol link
 func CreateSymbolicLink(filePath string, linkName string) error {
 	err := os.MkdirAll(filepath.Dir(filePath), 0755)
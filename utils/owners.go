@@ -0,0 +1,121 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Owners records owner of each file staged into one directory, e.g. sysroot
+// or root filesystem, so that files staged by different owners into the same
+// path are detected instead of silently overwritten
+// It's safe for concurrent use
+type Owners struct {
+	m        sync.Mutex
+	files    map[string]string // relative path -> owner
+	reserved map[string]bool   // paths managed by others, e.g. alternatives
+}
+
+// ConflictError reports files staged by more than one owner
+type ConflictError struct {
+	Conflicts []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("file conflicts are detected:\n\t%s",
+		strings.Join(e.Conflicts, "\n\t"))
+}
+
+// Reserve makes relative path @rel not staged by any owner
+func (o *Owners) Reserve(rel string) {
+
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if o.reserved == nil {
+		o.reserved = make(map[string]bool)
+	}
+	o.reserved[filepath.Clean(strings.TrimPrefix(rel, "/"))] = true
+}
+
+// Owner returns who stages relative path @rel
+func (o *Owners) Owner(rel string) string {
+
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.files[filepath.Clean(strings.TrimPrefix(rel, "/"))]
+}
+
+// claim records @owner stages relative path @rel
+// it returns another owner if @rel has been claimed by it
+func (o *Owners) claim(owner, rel string) (string, bool) {
+
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if o.files == nil {
+		o.files = make(map[string]string)
+	}
+	if prev, ok := o.files[rel]; ok && prev != owner {
+		return prev, false
+	}
+	o.files[rel] = owner
+	return "", true
+}
+
+// Stage stages files from directory @from to @to like Stage on behalf of
+// @owner. file which has been staged by another owner is not overwritten,
+// and a ConflictError reports all such files with both owners
+func (o *Owners) Stage(owner, from, to string) error {
+
+	if _, err := os.Lstat(from); os.IsNotExist(err) {
+		return nil
+	}
+
+	conflicts := []string{}
+	if err := filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(from, path)
+		dest := filepath.Join(to, rel)
+		if info.IsDir() {
+			os.MkdirAll(dest, info.Mode())
+			return nil
+		}
+
+		o.m.Lock()
+		reserved := o.reserved[rel]
+		o.m.Unlock()
+		if reserved {
+			return nil
+		}
+
+		if prev, ok := o.claim(owner, rel); !ok {
+			conflicts = append(conflicts, fmt.Sprintf("/%s is staged by both %s and %s",
+				rel, prev, owner))
+			return nil
+		}
+
+		if _, err := os.Lstat(dest); err == nil {
+			os.Remove(dest) // staged by the same owner before
+		}
+		return stageFile(path, dest, info)
+	}); err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
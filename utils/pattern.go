@@ -0,0 +1,143 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pattern matches relative path with delimiter '/'
+//
+// glob pattern syntax:
+//
+//	'*'     matches any sequence of non-separator characters
+//	'**'    matches any sequence of characters, including separator.
+//	        '**/' matches zero or more directories
+//	'?'     matches any single non-separator character
+//	[class] matches any single non-separator character in class, class can
+//	        be negated by leading '!' or '^', e.g. [!0-9]
+//	'\c'    matches character c
+//
+// glob pattern also matches all files under directory it matches, e.g.
+// usr/lib matches usr/lib/libz.so. glob pattern with trailing '/' only
+// matches directory, e.g. usr/lib/*/ matches usr/lib/foo/bar.so but
+// does not match usr/lib/libz.so
+//
+// regular expression pattern is matched against the whole relative path
+type pattern struct {
+	re      *regexp.Regexp
+	dirOnly bool // only match directory
+	prefix  bool // match directory prefix of path
+}
+
+// newGlob compiles glob pattern @glob
+func newGlob(glob string) (*pattern, error) {
+
+	p := &pattern{prefix: true}
+	if strings.HasSuffix(glob, "/") {
+		p.dirOnly = true
+		glob = strings.TrimRight(glob, "/")
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+
+		case '?':
+			b.WriteString("[^/]")
+
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("pattern %s has unclosed character class", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			i += end + 1
+
+			b.WriteString("[")
+			if strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^") {
+				b.WriteString("^/")
+				class = class[1:]
+			}
+			b.WriteString(strings.Replace(class, `\`, `\\`, -1))
+			b.WriteString("]")
+
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				c = glob[i]
+			}
+			b.WriteString(regexp.QuoteMeta(string(c)))
+
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("pattern %s: %s", glob, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+// newRegexp compiles regular expression @expr
+func newRegexp(expr string) (*pattern, error) {
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &pattern{re: re}, nil
+}
+
+// match returns whether relative path @rel is matched
+func (p *pattern) match(rel string) bool {
+
+	if !p.prefix {
+		return p.re.MatchString(rel)
+	}
+
+	// try each directory prefix, then the whole path
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' && p.re.MatchString(rel[:i]) {
+			return true
+		}
+	}
+	return !p.dirOnly && p.re.MatchString(rel)
+}
+
+// EscapePattern escapes all glob meta characters of @s
+func EscapePattern(s string) string {
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\', '!':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
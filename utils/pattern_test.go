@@ -0,0 +1,166 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package utils
+
+import "testing"
+
+func TestGlob(t *testing.T) {
+
+	tests := []struct {
+		glob string
+		rel  string
+		want bool
+	}{
+		// directory matches all files under it
+		{"usr/lib", "usr/lib", true},
+		{"usr/lib", "usr/lib/libz.so", true},
+		{"usr/lib", "usr/lib/pkgconfig/zlib.pc", true},
+		{"usr/lib", "usr/lib64/libz.so", false},
+		{"usr/share/doc", "usr/share/docs/README", false},
+
+		// '*' doesn't cross separator
+		{"usr/lib/*.so", "usr/lib/libz.so", true},
+		{"usr/lib/*.so", "usr/lib/libz.so.1", false},
+		{"usr/lib/*.so", "usr/lib/x/libz.so", false},
+		{"usr/lib/*.so.*", "usr/lib/libz.so.1.2", true},
+		{"usr/bin/*-config", "usr/bin/xml2-config", true},
+
+		// trailing '/' only matches directory
+		{"usr/lib/*/", "usr/lib/foo/bar.so", true},
+		{"usr/lib/*/", "usr/lib/libz.so", false},
+
+		// '**'
+		{"**/.debug/", "usr/bin/.debug/ls", true},
+		{"**/.debug/", ".debug/ls", true},
+		{"**/.debug/", "usr/bin/ls.debug", false},
+		{"**/*.la", "usr/lib/libz.la", true},
+		{"**/*.la", "libz.la", true},
+		{"usr/**", "usr/a/b/c", true},
+		{"usr/**.h", "usr/include/zlib.h", true},
+
+		// '?' and character class
+		{"usr/bin/?s", "usr/bin/ls", true},
+		{"usr/bin/?s", "usr/bin/cls", false},
+		{"lib[0-9].so", "lib1.so", true},
+		{"lib[0-9].so", "liba.so", false},
+		{"lib[!0-9].so", "liba.so", true},
+		{"lib[!0-9].so", "lib1.so", false},
+		{"lib[^0-9].so", "liba.so", true},
+		{"a[!x]b", "a/b", false}, // negated class doesn't match separator
+
+		// escape
+		{`usr/bin/a\*b`, "usr/bin/a*b", true},
+		{`usr/bin/a\*b`, "usr/bin/axb", false},
+		{`usr/bin/a.b`, "usr/bin/axb", false},
+		{`lib\[1\].so`, "lib[1].so", true},
+	}
+
+	for _, test := range tests {
+		p, err := newGlob(test.glob)
+		if err != nil {
+			t.Errorf("newGlob(%s): %s", test.glob, err)
+			continue
+		}
+		if got := p.match(test.rel); got != test.want {
+			t.Errorf("%s matches %s = %v, want %v", test.glob, test.rel, got, test.want)
+		}
+	}
+
+	if _, err := newGlob("usr/lib/lib[0-9"); err == nil {
+		t.Errorf("newGlob(usr/lib/lib[0-9) should fail")
+	}
+}
+
+func TestRegexp(t *testing.T) {
+
+	tests := []struct {
+		expr string
+		rel  string
+		want bool
+	}{
+		{`^usr/lib/lib[^/]*\.so\.[0-9]+$`, "usr/lib/libz.so.1", true},
+		{`^usr/lib/lib[^/]*\.so\.[0-9]+$`, "usr/lib/libz.so.1.2", false},
+		{`^usr/lib$`, "usr/lib/libz.so", false}, // not matched by directory
+		{`\.py[co]$`, "usr/lib/python3/foo.pyc", true},
+	}
+
+	for _, test := range tests {
+		p, err := newRegexp(test.expr)
+		if err != nil {
+			t.Errorf("newRegexp(%s): %s", test.expr, err)
+			continue
+		}
+		if got := p.match(test.rel); got != test.want {
+			t.Errorf("%s matches %s = %v, want %v", test.expr, test.rel, got, test.want)
+		}
+	}
+
+	if _, err := newRegexp(`usr/(lib`); err == nil {
+		t.Errorf("newRegexp(usr/(lib) should fail")
+	}
+}
+
+func TestEscapePattern(t *testing.T) {
+
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"usr/lib/libz.so", "usr/lib/libz.so"},
+		{"a*b?c", `a\*b\?c`},
+		{"[x]", `\[x\]`},
+		{`a\b`, `a\\b`},
+		{"!neg", `\!neg`},
+	}
+
+	for _, test := range tests {
+		got := EscapePattern(test.s)
+		if got != test.want {
+			t.Errorf("EscapePattern(%s) = %s, want %s", test.s, got, test.want)
+			continue
+		}
+		// escaped pattern matches string itself only
+		p, err := newGlob(got)
+		if err != nil {
+			t.Errorf("newGlob(%s): %s", got, err)
+			continue
+		}
+		if !p.match(test.s) {
+			t.Errorf("%s doesn't match %s", got, test.s)
+		}
+	}
+}
+
+func TestStageBoxMatch(t *testing.T) {
+
+	s := new(StageBox)
+	s.Push("usr/bin").Push("!usr/bin/*-config").Push("usr/lib/*.so.*")
+	s.PushRegexp(`^lib/modules/.*\.ko$`).PopRegexp(`/test_[^/]*\.ko$`)
+
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"usr/bin/ls", true},
+		{"usr/bin/xml2-config", false}, // black list wins
+		{"usr/lib/libz.so.1", true},
+		{"usr/lib/libz.so", false},
+		{"lib/modules/5.4/foo.ko", true},
+		{"lib/modules/5.4/test_foo.ko", false},
+		{"etc/passwd", false},
+	}
+
+	for _, test := range tests {
+		if got := s.Match(test.rel); got != test.want {
+			t.Errorf("Match(%s) = %v, want %v", test.rel, got, test.want)
+		}
+	}
+
+	// patterns pushed to clone don't change the original one
+	c := s.Clone().Push("etc")
+	if !c.Match("etc/passwd") || s.Match("etc/passwd") {
+		t.Errorf("Clone shares patterns with the original StageBox")
+	}
+}
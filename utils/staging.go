@@ -5,6 +5,7 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,52 +14,118 @@ import (
 )
 
 // StageBox represents state of stage
-// It stage file/dir in while list but exlcude file/dir in black list
+// It stages file/dir matched by white list but exlcude file/dir matched by
+// black list. Pattern syntax refers to type pattern
 type StageBox struct {
-	whiteList []string
-	blackList []string
+	whiteList []*pattern
+	blackList []*pattern
 }
 
-// Push adds file or directory @path to while list
+// Push adds glob pattern @path to white list
+// pattern with prefix '!' is negation, it's added to black list
 func (s *StageBox) Push(path string) *StageBox {
-	if filepath.IsAbs(path) {
-		panic("StageBox rejects ABS path")
+	if strings.HasPrefix(path, "!") {
+		return s.Pop(path[1:])
 	}
-	s.whiteList = append(s.whiteList, path)
+
+	s.whiteList = append(s.whiteList, mustGlob(path))
 	return s
 }
 
-// Pop adds file or directory @path to blank list
+// Pop adds glob pattern @path to blank list
 func (s *StageBox) Pop(path string) *StageBox {
+	s.blackList = append(s.blackList, mustGlob(path))
+	return s
+}
+
+// PushRegexp adds regular expression @expr to white list
+// expr is matched against the whole relative path, e.g. `^usr/lib/lib[^/]*\.so\.[0-9]+$`
+func (s *StageBox) PushRegexp(expr string) *StageBox {
+	p, err := newRegexp(expr)
+	if err != nil {
+		panic(fmt.Sprintf("StageBox rejects regexp: %s", err))
+	}
+	s.whiteList = append(s.whiteList, p)
+	return s
+}
+
+// PopRegexp adds regular expression @expr to black list
+func (s *StageBox) PopRegexp(expr string) *StageBox {
+	p, err := newRegexp(expr)
+	if err != nil {
+		panic(fmt.Sprintf("StageBox rejects regexp: %s", err))
+	}
+	s.blackList = append(s.blackList, p)
+	return s
+}
+
+func mustGlob(path string) *pattern {
 	if filepath.IsAbs(path) {
 		panic("StageBox rejects ABS path")
 	}
-	s.blackList = append(s.blackList, path)
-	return s
+	p, err := newGlob(filepath.ToSlash(filepath.Clean(path)) + trailingSlash(path))
+	if err != nil {
+		panic(fmt.Sprintf("StageBox rejects pattern: %s", err))
+	}
+	return p
 }
 
-// Stage creates hard links to copies of available files under from into directory to
-func (s *StageBox) Stage(from, to string) error {
+func trailingSlash(path string) string {
+	if strings.HasSuffix(path, "/") {
+		return "/"
+	}
+	return ""
+}
 
-	// stage white list
-	for _, w := range s.whiteList {
-		if err := Stage(filepath.Join(from, w),
-			filepath.Join(to, w)); err != nil {
-			return err
-		}
+// Clone returns copy of StageBox, patterns pushed to the copy don't change
+// the original one
+func (s *StageBox) Clone() *StageBox {
+	return &StageBox{
+		whiteList: append([]*pattern(nil), s.whiteList...),
+		blackList: append([]*pattern(nil), s.blackList...),
 	}
-	// remove dir/files in blacklist
+}
+
+// Match returns whether relative path @rel is matched by white list and not
+// matched by black list
+func (s *StageBox) Match(rel string) bool {
+
+	rel = filepath.ToSlash(rel)
 	for _, b := range s.blackList {
-		t := filepath.Join(to, b)
-		log.Trace("Remove %s\n", t)
-		os.RemoveAll(t)
+		if b.match(rel) {
+			return false
+		}
 	}
-	return nil
+	for _, w := range s.whiteList {
+		if w.match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stage creates hard links to copies of matched files under from into directory to
+func (s *StageBox) Stage(from, to string) error {
+
+	return filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(from, path)
+		if info.IsDir() || !s.Match(rel) {
+			return nil
+		}
+		return Stage(path, filepath.Join(to, rel))
+	})
 }
 
 // copy symbol link or create hard link
 func stageFile(from, to string, info os.FileInfo) error {
 
+	srcinfo, _ := os.Stat(filepath.Dir(from))
+	os.MkdirAll(filepath.Dir(to), srcinfo.Mode())
+
 	if info.Mode()&os.ModeSymlink != 0 {
 		from, err := os.Readlink(from)
 		if err != nil {
@@ -68,9 +135,6 @@ func stageFile(from, to string, info os.FileInfo) error {
 		return os.Symlink(from, to)
 	}
 
-	srcinfo, _ := os.Stat(filepath.Dir(from))
-	os.MkdirAll(filepath.Dir(to), srcinfo.Mode())
-
 	log.Trace("Create hark link:\n\t%s -->\n\t%s\n", from, to)
 	return os.Link(from, to)
 }
@@ -85,7 +149,7 @@ func stageFile(from, to string, info os.FileInfo) error {
 //   has the actual contents of original file, even if the original file moved or removed.
 func Stage(from, to string) error {
 
-	if info, err := os.Stat(from); err == nil && info.IsDir() {
+	if info, err := os.Lstat(from); err == nil && info.IsDir() {
 		log.Info("Staging recursively:\n\t%s -->\n\t%s\n", from, to)
 	} else if os.IsNotExist(err) {
 		return nil
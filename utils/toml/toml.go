@@ -0,0 +1,662 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package toml implements a parser of TOML subset used by declarative cartons
+//
+// Supported: comments, bare/quoted/dotted keys, tables, arrays of tables,
+// basic/literal strings and their multi-line forms, integers, floats,
+// booleans, arrays and inline tables. Date and time are not supported
+//
+// Tables are decoded into map[string]interface{}, arrays into []interface{},
+// integers into int64 and floats into float64
+package toml
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error reports where parsing fails
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Position records where one key is defined, it's used for error report
+type Position struct {
+	File string
+	Line int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// Document is parsed TOML document
+type Document struct {
+	Root map[string]interface{}
+
+	// dotted key path -> where it's defined, e.g. "packages.foo.files"
+	Positions map[string]Position
+}
+
+// ParseFile parses TOML file @file
+func ParseFile(file string) (*Document, error) {
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(file, data)
+}
+
+// Parse parses TOML @data, @file is only used for error report
+func Parse(file string, data []byte) (*Document, error) {
+
+	p := &parser{
+		data: data,
+		line: 1,
+		doc: &Document{
+			Root:      make(map[string]interface{}),
+			Positions: make(map[string]Position),
+		},
+		file:     file,
+		implicit: make(map[string]bool),
+		defined:  make(map[string]bool),
+	}
+	p.cur = p.doc.Root
+
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.doc, nil
+}
+
+type parser struct {
+	data []byte
+	pos  int
+	line int
+	file string
+
+	doc    *Document
+	cur    map[string]interface{} // current table
+	prefix string                 // dotted path of current table
+
+	implicit map[string]bool // tables created implicitly by dotted path
+	defined  map[string]bool // tables defined by header
+}
+
+func (p *parser) errorf(format string, v ...interface{}) error {
+	return &Error{File: p.file, Line: p.line, Msg: fmt.Sprintf(format, v...)}
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.data) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.data[p.pos:]), s)
+}
+
+func (p *parser) next() byte {
+	c := p.data[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipSpace skips blanks, and also newlines and comments if @multiline
+func (p *parser) skipSpace(multiline bool) {
+
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t':
+			p.next()
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.next()
+			}
+		case multiline && (c == '\n' || c == '\r'):
+			p.next()
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine expects only blanks or comment until end of line
+func (p *parser) endOfLine() error {
+
+	p.skipSpace(false)
+	if p.eof() {
+		return nil
+	}
+	if p.hasPrefix("\r\n") {
+		p.next()
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q at end of line", p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parse() error {
+
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil
+		}
+
+		var err error
+		if p.peek() == '[' {
+			err = p.parseHeader()
+		} else {
+			err = p.parseKeyValue(p.cur, p.prefix)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseHeader parses [table] or [[array of tables]]
+func (p *parser) parseHeader() error {
+
+	p.next()
+	array := false
+	if p.peek() == '[' {
+		p.next()
+		array = true
+	}
+
+	p.skipSpace(false)
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipSpace(false)
+
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !p.hasPrefix(closing) {
+		return p.errorf("table header is not closed by %s", closing)
+	}
+	p.pos += len(closing)
+
+	// walk into parent tables
+	table := p.doc.Root
+	path := ""
+	for _, key := range keys[:len(keys)-1] {
+		path = join(path, key)
+		if table, err = p.descend(table, key, path); err != nil {
+			return err
+		}
+	}
+
+	last := keys[len(keys)-1]
+	path = join(path, last)
+	p.doc.Positions[path] = Position{p.file, p.line}
+
+	if array {
+		v, ok := table[last]
+		if !ok {
+			v = []interface{}{}
+		}
+		list, ok := v.([]interface{})
+		if !ok || p.defined[path] {
+			return p.errorf("key %s is already defined as non-array", path)
+		}
+		t := make(map[string]interface{})
+		table[last] = append(list, t)
+		p.cur, p.prefix = t, path
+		return nil
+	}
+
+	if v, ok := table[last]; ok {
+		t, isTable := v.(map[string]interface{})
+		if !isTable || p.defined[path] || !p.implicit[path] {
+			return p.errorf("table %s is already defined", path)
+		}
+		p.defined[path] = true
+		p.cur, p.prefix = t, path
+		return nil
+	}
+
+	t := make(map[string]interface{})
+	table[last] = t
+	p.defined[path] = true
+	p.cur, p.prefix = t, path
+	return nil
+}
+
+// descend returns sub table @key of @table, it's created if not exists.
+// for array of tables, the last table is returned
+func (p *parser) descend(table map[string]interface{}, key, path string) (map[string]interface{}, error) {
+
+	v, ok := table[key]
+	if !ok {
+		t := make(map[string]interface{})
+		table[key] = t
+		p.implicit[path] = true
+		return t, nil
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case []interface{}:
+		if len(v) > 0 {
+			if t, ok := v[len(v)-1].(map[string]interface{}); ok {
+				return t, nil
+			}
+		}
+	}
+	return nil, p.errorf("key %s is not table", path)
+}
+
+// parseKeyValue parses key = value into @table whose path is @prefix
+func (p *parser) parseKeyValue(table map[string]interface{}, prefix string) error {
+
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+
+	p.skipSpace(false)
+	if p.peek() != '=' {
+		return p.errorf("expected '=' after key %s", strings.Join(keys, "."))
+	}
+	p.next()
+	p.skipSpace(false)
+
+	path := prefix
+	for _, key := range keys[:len(keys)-1] {
+		path = join(path, key)
+		if table, err = p.descend(table, key, path); err != nil {
+			return err
+		}
+	}
+
+	last := keys[len(keys)-1]
+	path = join(path, last)
+	if _, ok := table[last]; ok {
+		return p.errorf("key %s is already defined", path)
+	}
+
+	line := p.line
+	value, err := p.parseValue(path)
+	if err != nil {
+		return err
+	}
+	table[last] = value
+	p.doc.Positions[path] = Position{p.file, line}
+	return nil
+}
+
+// parseKey parses bare, quoted or dotted key
+func (p *parser) parseKey() ([]string, error) {
+
+	keys := []string{}
+	for {
+		p.skipSpace(false)
+
+		var key string
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		case c == '\'':
+			s, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKey(p.peek()) {
+				p.next()
+			}
+			if start == p.pos {
+				return nil, p.errorf("invalid key character %q", p.peek())
+			}
+			key = string(p.data[start:p.pos])
+		}
+		keys = append(keys, key)
+
+		p.skipSpace(false)
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.next()
+	}
+}
+
+func isBareKey(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-'
+}
+
+func (p *parser) parseValue(path string) (interface{}, error) {
+
+	switch c := p.peek(); {
+	case p.hasPrefix(`"""`):
+		return p.parseMultilineBasicString()
+	case p.hasPrefix(`'''`):
+		return p.parseMultilineLiteralString()
+	case c == '"':
+		return p.parseBasicString()
+	case c == '\'':
+		return p.parseLiteralString()
+	case c == '[':
+		return p.parseArray(path)
+	case c == '{':
+		return p.parseInlineTable(path)
+	case p.hasPrefix("true"):
+		p.pos += 4
+		return true, nil
+	case p.hasPrefix("false"):
+		p.pos += 5
+		return false, nil
+	case c == '+' || c == '-' || c >= '0' && c <= '9':
+		return p.parseNumber()
+	case c == 0:
+		return nil, p.errorf("missing value of key %s", path)
+	}
+	return nil, p.errorf("invalid value of key %s", path)
+}
+
+func (p *parser) parseNumber() (interface{}, error) {
+
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' ||
+			c == ']' || c == '}' || c == '#' {
+			break
+		}
+		p.next()
+	}
+	raw := string(p.data[start:p.pos])
+	s := strings.Replace(raw, "_", "", -1)
+
+	// integer with prefix 0x, 0o or 0b has no sign
+	if len(s) > 2 && s[0] == '0' {
+		base := 0
+		switch s[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+		if base != 0 {
+			if s[2] != '+' && s[2] != '-' {
+				if i, err := strconv.ParseUint(s[2:], base, 63); err == nil {
+					return int64(i), nil
+				}
+			}
+			return nil, p.errorf("invalid number %s", raw)
+		}
+	}
+
+	// decimal integer and float have no leading zeros
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		return nil, p.errorf("invalid number %s, leading zeros are not allowed", raw)
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if strings.Trim(digits, "0123456789.eE+-") == "" || digits == "inf" || digits == "nan" {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, p.errorf("invalid number %s, date and time are not supported", raw)
+}
+
+func (p *parser) parseArray(path string) (interface{}, error) {
+
+	p.next() // [
+	list := []interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.errorf("array %s is not closed", path)
+		}
+		if p.peek() == ']' {
+			p.next()
+			return list, nil
+		}
+
+		v, err := p.parseValue(path)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+
+		p.skipSpace(true)
+		switch p.peek() {
+		case ',':
+			p.next()
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']' in array %s", path)
+		}
+	}
+}
+
+func (p *parser) parseInlineTable(path string) (interface{}, error) {
+
+	p.next() // {
+	table := make(map[string]interface{})
+	p.skipSpace(false)
+	if p.peek() == '}' {
+		p.next()
+		return table, nil
+	}
+
+	for {
+		p.skipSpace(false)
+		if err := p.parseKeyValue(table, path); err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+
+		switch p.peek() {
+		case ',':
+			p.next()
+		case '}':
+			p.next()
+			return table, nil
+		default:
+			return nil, p.errorf("expected ',' or '}' in inline table %s", path)
+		}
+	}
+}
+
+func (p *parser) parseBasicString() (string, error) {
+
+	p.next() // "
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("string is not closed")
+		}
+		c := p.next()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if err := p.parseEscape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (p *parser) parseMultilineBasicString() (string, error) {
+
+	p.pos += 3
+	p.trimFirstNewline()
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("multi-line string is not closed")
+		}
+		if p.hasPrefix(`"""`) {
+			p.pos += 3
+			// up to two quotes are allowed right before closing delimiter
+			for i := 0; i < 2 && p.peek() == '"'; i++ {
+				b.WriteByte(p.next())
+			}
+			return b.String(), nil
+		}
+
+		c := p.next()
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+
+		// line ending backslash trims all whitespace until next non-whitespace
+		save, line := p.pos, p.line
+		for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+			p.next()
+		}
+		if p.peek() == '\n' || p.hasPrefix("\r\n") {
+			for !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+				p.next()
+			}
+			continue
+		}
+		p.pos, p.line = save, line
+		if err := p.parseEscape(&b); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (p *parser) parseLiteralString() (string, error) {
+
+	p.next() // '
+	start := p.pos
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("string is not closed")
+		}
+		if p.next() == '\'' {
+			return string(p.data[start : p.pos-1]), nil
+		}
+	}
+}
+
+func (p *parser) parseMultilineLiteralString() (string, error) {
+
+	p.pos += 3
+	p.trimFirstNewline()
+
+	start := p.pos
+	for {
+		if p.eof() {
+			return "", p.errorf("multi-line string is not closed")
+		}
+		if p.hasPrefix(`'''`) {
+			end := p.pos
+			p.pos += 3
+			for i := 0; i < 2 && p.peek() == '\''; i++ {
+				p.next()
+				end++
+			}
+			return string(p.data[start:end]), nil
+		}
+		p.next()
+	}
+}
+
+// trimFirstNewline skips newline immediately following opening delimiter
+func (p *parser) trimFirstNewline() {
+
+	if p.hasPrefix("\r\n") {
+		p.pos++
+	}
+	if p.peek() == '\n' {
+		p.next()
+	}
+}
+
+func (p *parser) parseEscape(b *strings.Builder) error {
+
+	if p.eof() {
+		return p.errorf("string is not closed")
+	}
+
+	switch c := p.next(); c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.data) {
+			return p.errorf("invalid unicode escape")
+		}
+		r, err := strconv.ParseUint(string(p.data[p.pos:p.pos+n]), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return p.errorf("invalid unicode escape")
+		}
+		p.pos += n
+		b.WriteRune(rune(r))
+	default:
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,262 @@
+// Copyright © 2020 Michael. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package toml
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseString(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`s = "hello"`, "hello"},
+		{`s = "tab\tnewline\nquote\"backslash\\"`, "tab\tnewline\nquote\"backslash\\"},
+		{`s = "\b\f\r"`, "\b\f\r"},
+		{`s = "\u00e9\U0001F600"`, "é😀"},
+		{`s = 'C:\path\no escape'`, `C:\path\no escape`},
+		{"s = \"\"\"\nline1\nline2\"\"\"", "line1\nline2"},
+		{"s = \"\"\"one \\\n    two\"\"\"", "one two"},
+		{"s = \"\"\"quote\"\"\"\"\"", "quote\"\""},
+		{"s = '''\nraw\\n\n'''", "raw\\n\n"},
+		{"s = '''it''''", "it'"},
+		{`"quoted key" = "v"`, ""},
+	}
+
+	for _, test := range tests {
+		doc, err := Parse("test.toml", []byte(test.in))
+		if err != nil {
+			t.Errorf("Parse(%q): %s", test.in, err)
+			continue
+		}
+		if test.want == "" {
+			if doc.Root["quoted key"] != "v" {
+				t.Errorf("Parse(%q) = %v", test.in, doc.Root)
+			}
+			continue
+		}
+		if got := doc.Root["s"]; got != test.want {
+			t.Errorf("Parse(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{"0", int64(0)},
+		{"+0", int64(0)},
+		{"-0", int64(0)},
+		{"42", int64(42)},
+		{"+17", int64(17)},
+		{"-17", int64(-17)},
+		{"1_000", int64(1000)},
+		{"0x1F", int64(31)},
+		{"0xdead_beef", int64(0xdeadbeef)},
+		{"0o755", int64(0755)},
+		{"0b1010", int64(10)},
+		{"3.14", 3.14},
+		{"-0.5", -0.5},
+		{"0.1", 0.1},
+		{"1e3", 1000.0},
+		{"6.02E-2", 0.0602},
+		{"+inf", math.Inf(1)},
+		{"-inf", math.Inf(-1)},
+	}
+
+	for _, test := range tests {
+		doc, err := Parse("test.toml", []byte("n = "+test.in))
+		if err != nil {
+			t.Errorf("Parse(%s): %s", test.in, err)
+			continue
+		}
+		if got := doc.Root["n"]; got != test.want {
+			t.Errorf("Parse(%s) = %#v, want %#v", test.in, got, test.want)
+		}
+	}
+
+	for _, in := range []string{
+		"010",        // leading zero, not octal
+		"-007",       // leading zeros
+		"00.5",       // leading zeros of float
+		"0755",       // octal needs prefix 0o
+		"-0x10",      // hex has no sign
+		"0x-10",      // sign after prefix
+		"0o8",        // invalid octal digit
+		"0b102",      // invalid binary digit
+		"0xg",        // invalid hex digit
+		"1979-05-27", // date isn't supported
+		"1.2.3",
+		"+0x1p4", // hex float
+	} {
+		if _, err := Parse("test.toml", []byte("n = "+in)); err == nil {
+			t.Errorf("Parse(%s) should fail", in)
+		}
+	}
+}
+
+func TestParseArray(t *testing.T) {
+
+	doc, err := Parse("test.toml", []byte(`
+ints = [1, 2, 3]
+strs = [
+	"a", # comment
+	'b',
+]
+nested = [[1, 2], ["x"]]
+mixed = [true, 1.5, { k = "v" }]
+empty = []
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"ints":   []interface{}{int64(1), int64(2), int64(3)},
+		"strs":   []interface{}{"a", "b"},
+		"nested": []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{"x"}},
+		"mixed":  []interface{}{true, 1.5, map[string]interface{}{"k": "v"}},
+		"empty":  []interface{}{},
+	}
+	if !reflect.DeepEqual(doc.Root, want) {
+		t.Errorf("Parse() = %#v, want %#v", doc.Root, want)
+	}
+}
+
+func TestParseInlineTable(t *testing.T) {
+
+	doc, err := Parse("test.toml", []byte(`
+vars = { CC = "gcc", opt.level = 2 }
+none = {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"vars": map[string]interface{}{
+			"CC":  "gcc",
+			"opt": map[string]interface{}{"level": int64(2)},
+		},
+		"none": map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(doc.Root, want) {
+		t.Errorf("Parse() = %#v, want %#v", doc.Root, want)
+	}
+	if pos := doc.Positions["vars.opt.level"]; pos.Line != 2 {
+		t.Errorf("position of vars.opt.level = %s, want line 2", pos)
+	}
+}
+
+func TestParseTable(t *testing.T) {
+
+	doc, err := Parse("test.toml", []byte(`
+name = "zlib"
+
+[packages.zlib-utils]
+files = ["usr/bin/*"]
+
+[[alternatives]]
+name = "a"
+
+[[alternatives]]
+name = "b"
+
+[alternatives.extra]
+priority = 10
+
+[a.b]
+c = 1
+
+[a]
+d = 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"name": "zlib",
+		"packages": map[string]interface{}{
+			"zlib-utils": map[string]interface{}{
+				"files": []interface{}{"usr/bin/*"},
+			},
+		},
+		"alternatives": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{
+				"name":  "b",
+				"extra": map[string]interface{}{"priority": int64(10)},
+			},
+		},
+		"a": map[string]interface{}{
+			"b": map[string]interface{}{"c": int64(1)},
+			"d": int64(2),
+		},
+	}
+	if !reflect.DeepEqual(doc.Root, want) {
+		t.Errorf("Parse() = %#v, want %#v", doc.Root, want)
+	}
+
+	for path, line := range map[string]int{
+		"name":                        2,
+		"packages.zlib-utils":         4,
+		"packages.zlib-utils.files":   5,
+		"alternatives":                10,
+		"alternatives.extra.priority": 14,
+	} {
+		if pos := doc.Positions[path]; pos.File != "test.toml" || pos.Line != line {
+			t.Errorf("position of %s = %s, want test.toml:%d", path, pos, line)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		line int
+	}{
+		{"a = 1\na = 2", 2},        // duplicated key
+		{"[t]\nx = 1\n[t]", 3},     // duplicated table
+		{"a = 1\n\nb = \"open", 3}, // string is not closed
+		{"a = [1,\n2\n", 3},        // array is not closed
+		{"a = { x = 1\n}", 1},      // inline table spans lines
+		{"a = 1 b = 2", 1},         // garbage at end of line
+		{"a = \"\\q\"", 1},         // invalid escape
+		{"a = \"\\u12\"", 1},       // invalid unicode escape
+		{"\n\n\nkey", 4},           // missing '='
+		{"a =", 1},                 // missing value
+		{"a = nope", 1},            // invalid value
+		{"a = 1\n[a.b]", 2},        // key isn't table
+		{"[x]\n[[x]]", 2},          // table isn't array
+		{"[t\nx = 1", 1},           // header isn't closed
+		{"a = 1\nb = 010", 2},      // leading zero
+		{"a = '''\nnot closed", 2}, // multi-line string isn't closed
+		{"s = \"\"\"\n\n\n", 4},    // multi-line string isn't closed
+		{"a.b = 1\n[a]\nb = 2", 3}, // key defined by dotted key
+		{"= 1", 1},                 // empty key
+	}
+
+	for _, test := range tests {
+		_, err := Parse("test.toml", []byte(test.in))
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Parse(%q) = %v, want *Error", test.in, err)
+			continue
+		}
+		if e.File != "test.toml" || e.Line != test.line {
+			t.Errorf("Parse(%q) fails at %s:%d, want test.toml:%d (%s)",
+				test.in, e.File, e.Line, test.line, e.Msg)
+		}
+	}
+}